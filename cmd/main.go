@@ -1,7 +1,29 @@
 package main
 
-import "github.com/Ser9unin/WeatherForecast/pkg/server"
+import (
+	"os"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/server"
+)
 
 func main() {
+	// main migrate status|up|down - управление схемой БД без запуска сервиса
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		server.Migrate(os.Args[2:])
+		return
+	}
+
+	// main apikey create|list|revoke - управление ключами API, в том числе создание первого ключа администратора
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		server.APIKey(os.Args[2:])
+		return
+	}
+
+	// main openapi check - сверка маршрутов с описанием API, например в CI
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		server.OpenAPI(os.Args[2:])
+		return
+	}
+
 	server.Run()
 }
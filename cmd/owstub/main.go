@@ -0,0 +1,233 @@
+// owstub заглушка API openweathermap.org для локальной разработки, CI и работы без сети.
+// Реализует /geo/1.0/direct и /data/2.5/forecast, ответы берутся из файлов с фикстурами.
+//
+// Ошибки openweather воспроизводятся так:
+//   - без appid или с appid не равным -appid ответ 401
+//   - больше -rpm запросов в минуту ответ 429 с заголовком Retry-After
+//   - appid=stub-401, appid=stub-429 и appid=stub-500 всегда отдают соответствующую ошибку
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"go.uber.org/zap"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "адрес, на котором слушает заглушка")
+	geoFile := flag.String("geo", "cmd/owstub/fixtures/geo.json", "файл с ответом /geo/1.0/direct для всех городов")
+	forecastFile := flag.String("forecast", "pkg/model.json", "файл с ответом /data/2.5/forecast")
+	appID := flag.String("appid", "", "ожидаемый ключ API, если пустой принимается любой непустой ключ")
+	rpm := flag.Int("rpm", 0, "лимит запросов в минуту, 0 без ограничения")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	stub, err := newStub(*geoFile, *forecastFile, *appID, *rpm)
+	if err != nil {
+		logger.Fatal("не загружены фикстуры", zap.Error(err))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(openweather.APIcities, stub.check(stub.geo))
+	mux.HandleFunc(openweather.APIFcast, stub.check(stub.forecast))
+
+	logger.Info("запускается заглушка openweather", zap.String("addr", *addr))
+	err = http.ListenAndServe(*addr, mux)
+	if err != nil {
+		logger.Fatal("заглушка остановлена", zap.Error(err))
+	}
+}
+
+type stub struct {
+	cities   []openweather.CityGeoData
+	raw      openweather.ForecastRawData
+	provider *openweather.FakeProvider
+	appID    string
+	rpm      int
+
+	mu          sync.Mutex
+	window      time.Time
+	windowCount int
+}
+
+func newStub(geoFile, forecastFile, appID string, rpm int) (*stub, error) {
+	s := &stub{
+		appID: appID,
+		rpm:   rpm,
+	}
+
+	geo, err := os.ReadFile(geoFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(geo, &s.cities)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", geoFile, err)
+	}
+
+	fixture, err := os.ReadFile(forecastFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(fixture, &s.raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", forecastFile, err)
+	}
+
+	// время в прогнозе сдвигается к текущему моменту так же как в FakeProvider
+	s.provider, err = openweather.NewFakeProvider(fixture)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", forecastFile, err)
+	}
+
+	return s, nil
+}
+
+// check проверяет ключ API и лимит запросов так же как openweather
+func (s *stub) check(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appID := r.URL.Query().Get("appid")
+
+		switch {
+		case appID == "stub-500":
+			writeError(w, http.StatusInternalServerError, "Internal error")
+			return
+		case appID == "stub-429":
+			w.Header().Set("Retry-After", "60")
+			writeError(w, http.StatusTooManyRequests, "Your account is temporary blocked due to exceeding of requests limitation of your subscription type.")
+			return
+		case appID == "" || appID == "stub-401" || (s.appID != "" && appID != s.appID):
+			writeError(w, http.StatusUnauthorized, "Invalid API key. Please see https://openweathermap.org/faq#error401 for more info.")
+			return
+		}
+
+		if retryAfter, ok := s.allow(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "Your account is temporary blocked due to exceeding of requests limitation of your subscription type.")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// считаем запросы в окне длиной минута
+func (s *stub) allow() (time.Duration, bool) {
+	if s.rpm <= 0 {
+		return 0, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.window) >= time.Minute {
+		s.window = now
+		s.windowCount = 0
+	}
+
+	if s.windowCount >= s.rpm {
+		return time.Minute - now.Sub(s.window), false
+	}
+	s.windowCount++
+
+	return 0, true
+}
+
+func (s *stub) geo(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "Nothing to geocode")
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 5 {
+		limit = 5
+	}
+
+	// как и в openweather в q может быть указана страна через запятую: "Moscow,RU"
+	name, country, _ := strings.Cut(q, ",")
+
+	found := make([]openweather.CityGeoData, 0, limit)
+	for _, city := range s.cities {
+		if len(found) == limit {
+			break
+		}
+		if !strings.EqualFold(city.Name, strings.TrimSpace(name)) {
+			continue
+		}
+		if country != "" && !strings.EqualFold(city.Country, strings.TrimSpace(country)) {
+			continue
+		}
+		found = append(found, city)
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func (s *stub) forecast(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		writeError(w, http.StatusBadRequest, "wrong latitude")
+		return
+	}
+
+	lon, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		writeError(w, http.StatusBadRequest, "wrong longitude")
+		return
+	}
+
+	forecast, err := s.provider.FetchCityForecast(r.Context(), lat, lon)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	raw := s.raw
+	raw.Cod = "200"
+	raw.Message = 0
+	raw.Cnt = len(forecast.List)
+	raw.List = make([]openweather.ListData, 0, len(forecast.List))
+	for _, item := range forecast.List {
+		raw.List = append(raw.List, item.ForecastData)
+	}
+	raw.City.Coord.Lat = lat
+	raw.City.Coord.Lon = lon
+	raw.City.Timezone = forecast.Timezone
+	raw.City.Sunrise = int(forecast.Sunrise)
+	raw.City.Sunset = int(forecast.Sunset)
+
+	writeJSON(w, http.StatusOK, raw)
+}
+
+// ответ с ошибкой в формате openweather
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"cod":     strconv.Itoa(status),
+		"message": message,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -3,7 +3,13 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
 )
 
 const Requestlimit = "1"
@@ -15,6 +21,8 @@ type DBConnectionCfg struct {
 	Password    string
 	DBName      string
 	SSLMode     string
+	// применять миграции при старте сервиса, DB_AUTO_MIGRATE=false отключает
+	AutoMigrate bool
 }
 
 func NewDBConnectionCfg() DBConnectionCfg {
@@ -25,6 +33,7 @@ func NewDBConnectionCfg() DBConnectionCfg {
 	cfg.Password = os.Getenv("POSTGRES_PASSWORD")
 	cfg.DBName = os.Getenv("POSTGRES_DB")
 	cfg.SSLMode = os.Getenv("SSL_MODE")
+	cfg.AutoMigrate = os.Getenv("DB_AUTO_MIGRATE") != "false"
 
 	someIsEmpty := false
 
@@ -65,19 +74,63 @@ func NewDBConnectionCfg() DBConnectionCfg {
 	return cfg
 }
 
-type OpenWeatherAPIID struct {
-	APIID string
+const (
+	ProviderOpenWeather = "openweather"
+	ProviderFake        = "fake"
+)
+
+// ProviderCfg описывает источник прогнозов:
+// openweather - реальный сервис, нужен OPENWEATHERAPI_ID
+// fake - данные из файла FAKE_FORECAST_FILE, работает без сети и без ключа
+// OPENWEATHER_BASE_URL позволяет направить запросы openweather на другой адрес, например на cmd/owstub
+// OPENWEATHER_RPM и OPENWEATHER_RPD лимиты тарифа в минуту и в сутки, общие для всех запросов, 0 без ограничения
+// OPENWEATHER_TIMEOUT таймаут одной попытки, OPENWEATHER_RETRIES количество повторов при 5xx, 429 и сетевых ошибках,
+// после OPENWEATHER_BREAKER_THRESHOLD неудач подряд запросы не отправляются OPENWEATHER_BREAKER_COOLDOWN
+type ProviderCfg struct {
+	Provider          string
+	APIID             string
+	BaseURL           string
+	FakeFixture       string
+	RequestsPerMinute int
+	RequestsPerDay    int
+	Timeout           time.Duration
+	Retries           int
+	BreakerThreshold  int
+	BreakerCooldown   time.Duration
 }
 
-func NewOpenWeatherAPIID() OpenWeatherAPIID {
-	cfg := OpenWeatherAPIID{}
+func NewProviderCfg() ProviderCfg {
+	cfg := ProviderCfg{}
+	cfg.Provider = os.Getenv("FORECAST_PROVIDER")
 	cfg.APIID = os.Getenv("OPENWEATHERAPI_ID")
+	cfg.BaseURL = os.Getenv("OPENWEATHER_BASE_URL")
+	cfg.FakeFixture = os.Getenv("FAKE_FORECAST_FILE")
+	cfg.RequestsPerMinute = getInt("OPENWEATHER_RPM", 60)
+	cfg.RequestsPerDay = getInt("OPENWEATHER_RPD", 0)
+	cfg.Timeout = getDuration("OPENWEATHER_TIMEOUT", 10*time.Second)
+	cfg.Retries = getInt("OPENWEATHER_RETRIES", 3)
+	cfg.BreakerThreshold = getInt("OPENWEATHER_BREAKER_THRESHOLD", 5)
+	cfg.BreakerCooldown = getDuration("OPENWEATHER_BREAKER_COOLDOWN", 30*time.Second)
+
+	if cfg.Provider == "" {
+		cfg.Provider = ProviderOpenWeather
+	}
+
+	if cfg.FakeFixture == "" {
+		cfg.FakeFixture = "pkg/model.json"
+	}
 
 	someIsEmpty := false
 
-	if cfg.APIID == "" {
-		log.Println("OPENWEATHERAPI_ID env variable is empty")
-		someIsEmpty = true
+	switch cfg.Provider {
+	case ProviderOpenWeather:
+		if cfg.APIID == "" {
+			log.Println("OPENWEATHERAPI_ID env variable is empty")
+			someIsEmpty = true
+		}
+	case ProviderFake:
+	default:
+		log.Fatalf("unknown FORECAST_PROVIDER: %s", cfg.Provider)
 	}
 
 	if someIsEmpty {
@@ -87,6 +140,150 @@ func NewOpenWeatherAPIID() OpenWeatherAPIID {
 	return cfg
 }
 
+// города, которыми заполняется пустая БД, если SEED_CITIES не задан
+const defaultSeedCities = "Moscow,Nizhny Novgorod,Saint Petersburg"
+
+type IngestionCfg struct {
+	SeedCities []string
+}
+
+func NewIngestionCfg() IngestionCfg {
+	cfg := IngestionCfg{}
+
+	seed, ok := os.LookupEnv("SEED_CITIES")
+	if !ok {
+		seed = defaultSeedCities
+	}
+
+	for _, city := range strings.Split(seed, ",") {
+		city = strings.TrimSpace(city)
+		if city != "" {
+			cfg.SeedCities = append(cfg.SeedCities, city)
+		}
+	}
+
+	return cfg
+}
+
+// CacheCfg время жизни записей кэша прогнозов, по умолчанию совпадает с интервалом обновления прогноза
+type CacheCfg struct {
+	TTL time.Duration
+}
+
+func NewCacheCfg() CacheCfg {
+	cfg := CacheCfg{}
+	cfg.TTL = getDuration("CACHE_TTL", 15*time.Minute)
+
+	return cfg
+}
+
+// PointCfg прогноз по произвольным координатам, полученный от источника по запросу пользователя:
+// POINT_CACHE_TTL время жизни прогноза в кэше, POINT_RATE отдельный лимит таких запросов к источнику
+// вида 20/1m, что бы они не расходовали весь общий лимит, нужный для обновления городов,
+// POINT_FETCH_TIMEOUT сколько запрос ждёт источник, включая очередь в общем ограничителе и повторы
+type PointCfg struct {
+	TTL     time.Duration
+	Rate    ratelimit.Rate
+	Timeout time.Duration
+}
+
+func NewPointCfg() PointCfg {
+	cfg := PointCfg{}
+	cfg.TTL = getDuration("POINT_CACHE_TTL", 15*time.Minute)
+	cfg.Rate = getRate("POINT_RATE", ratelimit.Rate{Limit: 20, Per: time.Minute})
+	cfg.Timeout = getDuration("POINT_FETCH_TIMEOUT", 15*time.Second)
+
+	return cfg
+}
+
+// APICfg настройки HTTP API, DEFAULT_UNITS система единиц по умолчанию: metric, imperial или standard
+type APICfg struct {
+	DefaultUnits string
+}
+
+func NewAPICfg() APICfg {
+	cfg := APICfg{}
+	cfg.DefaultUnits = os.Getenv("DEFAULT_UNITS")
+
+	switch cfg.DefaultUnits {
+	case "":
+		cfg.DefaultUnits = "metric"
+	case "metric", "imperial", "standard":
+	default:
+		log.Fatalf("unknown DEFAULT_UNITS: %s", cfg.DefaultUnits)
+	}
+
+	return cfg
+}
+
+// AuthCfg AUTH_ENABLED=true требует ключ API во всех запросах к API, по умолчанию запросы без ключа проходят,
+// управление ключами /admin/keys всегда требует ключ администратора
+type AuthCfg struct {
+	Enabled bool
+}
+
+func NewAuthCfg() AuthCfg {
+	cfg := AuthCfg{}
+	cfg.Enabled = os.Getenv("AUTH_ENABLED") == "true"
+
+	return cfg
+}
+
+// RateLimitCfg ограничение частоты запросов каждого клиента (ключа API, а без ключа адреса),
+// RATE_LIMIT по умолчанию для всех маршрутов в виде 60/1m, 0 без ограничения,
+// RATE_LIMIT_ROUTES отдельные лимиты маршрутов: /get_full_forecast=20/1m,/forecasts=10/1m,
+// TRUSTED_PROXIES адреса или подсети прокси через запятую, от них адрес клиента берётся из X-Forwarded-For
+type RateLimitCfg struct {
+	Default        ratelimit.Rate
+	Routes         map[string]ratelimit.Rate
+	TrustedProxies []*net.IPNet
+}
+
+func NewRateLimitCfg() RateLimitCfg {
+	cfg := RateLimitCfg{}
+	cfg.Default = getRate("RATE_LIMIT", ratelimit.Rate{Limit: 60, Per: time.Minute})
+	cfg.Routes = make(map[string]ratelimit.Rate)
+
+	for _, item := range splitList(os.Getenv("RATE_LIMIT_ROUTES")) {
+		route, value, ok := strings.Cut(item, "=")
+		rate, err := parseRate(value)
+		if !ok || err != nil {
+			log.Fatalf("RATE_LIMIT_ROUTES env variable is wrong: %q", item)
+		}
+		cfg.Routes[strings.TrimSpace(route)] = rate
+	}
+
+	for _, item := range splitList(os.Getenv("TRUSTED_PROXIES")) {
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Fatalf("TRUSTED_PROXIES env variable is wrong: %s", err)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, network)
+	}
+
+	return cfg
+}
+
+// HealthCfg настройки проверки готовности, сервис не готов, если последний прогноз загружен раньше MaxForecastAge
+type HealthCfg struct {
+	MaxForecastAge time.Duration
+}
+
+func NewHealthCfg() HealthCfg {
+	cfg := HealthCfg{}
+	cfg.MaxForecastAge = getDuration("READY_MAX_FORECAST_AGE", time.Hour)
+
+	return cfg
+}
+
 type ServerCfg struct {
 	Port string
 }
@@ -110,3 +307,85 @@ func NewServerCfg() ServerCfg {
 
 	return cfg
 }
+
+// читаем длительность вида 15m или 1h30m, при пустой переменной возвращаем значение по умолчанию
+func getDuration(env string, def time.Duration) time.Duration {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s env variable is wrong: %s", env, err)
+	}
+
+	return d
+}
+
+func getInt(env string, def int) int {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s env variable is wrong: %s", env, err)
+	}
+
+	return i
+}
+
+// читаем лимит вида 60/1m, 0 без ограничения
+func getRate(env string, def ratelimit.Rate) ratelimit.Rate {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+
+	rate, err := parseRate(value)
+	if err != nil {
+		log.Fatalf("%s env variable is wrong: %s", env, err)
+	}
+
+	return rate
+}
+
+func parseRate(value string) (ratelimit.Rate, error) {
+	value = strings.TrimSpace(value)
+	if value == "0" {
+		return ratelimit.Rate{}, nil
+	}
+
+	limit, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return ratelimit.Rate{}, fmt.Errorf("rate should be in format 60/1m: %q", value)
+	}
+
+	rate := ratelimit.Rate{}
+	var err error
+	rate.Limit, err = strconv.Atoi(limit)
+	if err != nil {
+		return ratelimit.Rate{}, err
+	}
+	rate.Per, err = time.ParseDuration(per)
+	if err != nil {
+		return ratelimit.Rate{}, err
+	}
+
+	return rate, nil
+}
+
+// непустые элементы списка через запятую
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,258 @@
+// Package alerts проверяет правила оповещений по прогнозу после каждой записи прогноза по городу в БД
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Kind вид значения поля прогноза, от него зависит перевод порога в другую систему единиц
+type Kind int
+
+const (
+	KindPlain Kind = iota
+	KindTemperature
+	KindSpeed
+)
+
+// Fields поля записи прогноза, по которым можно задать правило, названия как в ForecastSlot
+var Fields = map[string]Kind{
+	"temp":       KindTemperature,
+	"feels_like": KindTemperature,
+	"temp_min":   KindTemperature,
+	"temp_max":   KindTemperature,
+	"pressure":   KindPlain,
+	"humidity":   KindPlain,
+	"clouds":     KindPlain,
+	"visibility": KindPlain,
+	"pop":        KindPlain,
+	"rain_3h":    KindPlain,
+	"wind_speed": KindSpeed,
+	"wind_gust":  KindSpeed,
+}
+
+// операторы сравнения значения с порогом
+const (
+	OperatorLT  = "lt"
+	OperatorLTE = "lte"
+	OperatorGT  = "gt"
+	OperatorGTE = "gte"
+)
+
+// запись прогноза действует 3 часа, запись, начавшаяся до текущего времени, тоже проверяется
+const slotDuration = 3 * time.Hour
+
+// ValidOperator true для lt, lte, gt и gte
+func ValidOperator(operator string) bool {
+	switch operator {
+	case OperatorLT, OperatorLTE, OperatorGT, OperatorGTE:
+		return true
+	default:
+		return false
+	}
+}
+
+// Value значение поля в записи прогноза в единицах БД: кельвины и м/с
+func Value(field string, data openweather.ListData) (float64, bool) {
+	switch field {
+	case "temp":
+		return data.Main.Temp, true
+	case "feels_like":
+		return data.Main.FeelsLike, true
+	case "temp_min":
+		return data.Main.TempMin, true
+	case "temp_max":
+		return data.Main.TempMax, true
+	case "pressure":
+		return float64(data.Main.Pressure), true
+	case "humidity":
+		return float64(data.Main.Humidity), true
+	case "clouds":
+		return float64(data.Clouds.All), true
+	case "visibility":
+		return float64(data.Visibility), true
+	case "pop":
+		return data.Pop, true
+	case "rain_3h":
+		return data.Rain.ThreeH, true
+	case "wind_speed":
+		return data.Wind.Speed, true
+	case "wind_gust":
+		return data.Wind.Gust, true
+	default:
+		return 0, false
+	}
+}
+
+// Crossed true, если значение пересекает порог правила
+func Crossed(operator string, value, threshold float64) bool {
+	switch operator {
+	case OperatorLT:
+		return value < threshold
+	case OperatorLTE:
+		return value <= threshold
+	case OperatorGT:
+		return value > threshold
+	case OperatorGTE:
+		return value >= threshold
+	default:
+		return false
+	}
+}
+
+// Match запись прогноза, на которой правило сработало сильнее всего:
+// самое низкое значение для lt и lte, самое высокое для gt и gte
+type Match struct {
+	Date  int64
+	Value float64
+}
+
+// Evaluate проверяет правило на записях прогноза от now до now + lookahead_hours,
+// false если ни одна запись не пересекает порог
+func Evaluate(rule repository.AlertRule, forecasts []openweather.Forecast, now time.Time) (Match, bool) {
+	from := now.Add(-slotDuration).Unix()
+	to := now.Add(time.Duration(rule.LookaheadHours) * time.Hour).Unix()
+	lower := rule.Operator == OperatorLT || rule.Operator == OperatorLTE
+
+	var match Match
+	var found bool
+	for _, fc := range forecasts {
+		if fc.Date <= from || fc.Date > to {
+			continue
+		}
+
+		value, ok := Value(rule.Field, fc.ForecastData)
+		if !ok || !Crossed(rule.Operator, value, rule.Threshold) {
+			continue
+		}
+
+		if !found || lower && value < match.Value || !lower && value > match.Value {
+			match = Match{Date: fc.Date, Value: value}
+			found = true
+		}
+	}
+
+	return match, found
+}
+
+// Engine проверяет правила города при каждом обновлении прогноза, подписывается через AddListener.
+// По правилу открыто не больше одного события: пока прогноз пересекает порог, событие остаётся открытым,
+// когда перестаёт - событие снимается
+type Engine struct {
+	repo   *repository.Queries
+	logger *zap.Logger
+}
+
+func NewEngine(db *repository.Queries, logger *zap.Logger) *Engine {
+	return &Engine{
+		repo:   db,
+		logger: logger,
+	}
+}
+
+// CityUpdated проверяет правила города по записанному прогнозу
+func (e *Engine) CityUpdated(ctx context.Context, cityID int32) {
+	rules, err := e.repo.AlertRules(ctx, cityID)
+	if err != nil {
+		e.logger.Error("не получены правила оповещений:", zap.Int32("cityID", cityID), zap.Error(err))
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var lookahead int32
+	for _, rule := range rules {
+		lookahead = max(lookahead, rule.LookaheadHours)
+	}
+
+	forecasts, ok := e.forecasts(ctx, cityID, lookahead, now)
+	if !ok {
+		return
+	}
+
+	for _, rule := range rules {
+		e.apply(ctx, rule, forecasts, now)
+	}
+}
+
+// EvaluateRule проверяет новое правило по уже записанному прогнозу, не дожидаясь следующего обновления города
+func (e *Engine) EvaluateRule(ctx context.Context, rule repository.AlertRule) {
+	now := time.Now()
+
+	forecasts, ok := e.forecasts(ctx, rule.CityID, rule.LookaheadHours, now)
+	if !ok {
+		return
+	}
+
+	e.apply(ctx, rule, forecasts, now)
+}
+
+// записи прогноза города от now - 3 часа до now + lookahead часов, false если прогноз не прочитан
+func (e *Engine) forecasts(ctx context.Context, cityID int32, lookahead int32, now time.Time) ([]openweather.Forecast, bool) {
+	rows, err := e.repo.ForecastRange(ctx, repository.ForecastRangeParams{
+		CityID:   cityID,
+		DateFrom: now.Add(-slotDuration).Unix(),
+		DateTo:   now.Add(time.Duration(lookahead) * time.Hour).Unix(),
+	})
+	if err != nil {
+		e.logger.Error("не получен прогноз для оповещений:", zap.Int32("cityID", cityID), zap.Error(err))
+		return nil, false
+	}
+
+	forecasts := make([]openweather.Forecast, 0, len(rows))
+	for _, row := range rows {
+		var fc openweather.Forecast
+		err := json.Unmarshal(row.Weather, &fc)
+		if err != nil {
+			e.logger.Error("неверный формат прогноза:", zap.Int32("cityID", cityID), zap.Error(err))
+			return nil, false
+		}
+		fc.Date = row.Date
+		forecasts = append(forecasts, fc)
+	}
+
+	return forecasts, true
+}
+
+func (e *Engine) apply(ctx context.Context, rule repository.AlertRule, forecasts []openweather.Forecast, now time.Time) {
+	match, ok := Evaluate(rule, forecasts, now)
+	if !ok {
+		resolved, err := e.repo.ResolveAlert(ctx, rule.ID)
+		if err != nil {
+			e.logger.Error("не снято оповещение:", zap.Int32("ruleID", rule.ID), zap.Error(err))
+			return
+		}
+		if resolved > 0 {
+			metrics.AlertEvent("resolved")
+			e.logger.Info("оповещение снято", zap.Int32("ruleID", rule.ID), zap.Int32("cityID", rule.CityID))
+		}
+		return
+	}
+
+	triggered, err := e.repo.TriggerAlert(ctx, repository.TriggerAlertParams{
+		RuleID:       rule.ID,
+		CityID:       rule.CityID,
+		ForecastDate: match.Date,
+		Value:        match.Value,
+	})
+	if err != nil {
+		e.logger.Error("не записано оповещение:", zap.Int32("ruleID", rule.ID), zap.Error(err))
+		return
+	}
+	if triggered > 0 {
+		metrics.AlertEvent("triggered")
+		e.logger.Info("сработало оповещение",
+			zap.Int32("ruleID", rule.ID),
+			zap.Int32("cityID", rule.CityID),
+			zap.String("field", rule.Field),
+			zap.Float64("value", match.Value))
+	}
+}
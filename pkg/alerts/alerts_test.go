@@ -0,0 +1,232 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"go.uber.org/zap"
+)
+
+var testNow = time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+// запись прогноза на date с температурой temp в кельвинах
+func forecastAt(date time.Time, temp float64) openweather.Forecast {
+	fc := openweather.Forecast{Date: date.Unix()}
+	fc.ForecastData.Main.Temp = temp
+
+	return fc
+}
+
+func TestCrossed(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		want     bool
+	}{
+		{OperatorLT, 9, true},
+		{OperatorLT, 10, false},
+		{OperatorLTE, 10, true},
+		{OperatorLTE, 11, false},
+		{OperatorGT, 11, true},
+		{OperatorGT, 10, false},
+		{OperatorGTE, 10, true},
+		{OperatorGTE, 9, false},
+		{"eq", 10, false},
+	}
+
+	for _, tt := range tests {
+		got := Crossed(tt.operator, tt.value, 10)
+		if got != tt.want {
+			t.Errorf("Crossed(%s, %v, 10) = %v, want %v", tt.operator, tt.value, got, tt.want)
+		}
+	}
+}
+
+// каждое поле из Fields должно читаться из записи прогноза
+func TestValueFields(t *testing.T) {
+	for field := range Fields {
+		if _, ok := Value(field, openweather.ListData{}); !ok {
+			t.Errorf("Value(%q): field is not read", field)
+		}
+	}
+	if _, ok := Value("snow_3h", openweather.ListData{}); ok {
+		t.Error("Value(snow_3h): unknown field is read")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	from := testNow.Add(-slotDuration)
+	to := testNow.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		operator  string
+		forecasts []openweather.Forecast
+		want      Match
+		wantFound bool
+	}{
+		{
+			name:     "start of window is excluded",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(from, 250),
+			},
+		},
+		{
+			name:     "slot that began before now is included",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(from.Add(time.Second), 250),
+			},
+			want:      Match{Date: from.Add(time.Second).Unix(), Value: 250},
+			wantFound: true,
+		},
+		{
+			name:     "end of window is included",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(to, 250),
+			},
+			want:      Match{Date: to.Unix(), Value: 250},
+			wantFound: true,
+		},
+		{
+			name:     "after lookahead is excluded",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(to.Add(time.Second), 250),
+			},
+		},
+		{
+			name:     "lt takes the lowest value",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(testNow.Add(3*time.Hour), 250),
+				forecastAt(testNow.Add(6*time.Hour), 245),
+				forecastAt(testNow.Add(9*time.Hour), 252),
+				forecastAt(testNow.Add(12*time.Hour), 270),
+			},
+			want:      Match{Date: testNow.Add(6 * time.Hour).Unix(), Value: 245},
+			wantFound: true,
+		},
+		{
+			name:     "gt takes the highest value",
+			operator: OperatorGT,
+			forecasts: []openweather.Forecast{
+				forecastAt(testNow.Add(3*time.Hour), 250),
+				forecastAt(testNow.Add(6*time.Hour), 262),
+				forecastAt(testNow.Add(9*time.Hour), 258),
+				// самое высокое значение, но за пределами окна
+				forecastAt(to.Add(3*time.Hour), 280),
+			},
+			want:      Match{Date: testNow.Add(6 * time.Hour).Unix(), Value: 262},
+			wantFound: true,
+		},
+		{
+			name:     "clear forecast",
+			operator: OperatorLT,
+			forecasts: []openweather.Forecast{
+				forecastAt(testNow.Add(3*time.Hour), 260),
+				forecastAt(testNow.Add(6*time.Hour), 270),
+			},
+		},
+		{
+			name:     "no forecast",
+			operator: OperatorLT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := repository.AlertRule{Field: "temp", Operator: tt.operator, Threshold: 255, LookaheadHours: 24}
+
+			got, found := Evaluate(rule, tt.forecasts, testNow)
+			if found != tt.wantFound || got != tt.want {
+				t.Errorf("got %+v, %v, want %+v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+// TestEngineApply прогоняет правило по последовательности прогнозов:
+// пока порог пересечён, открыто одно событие, когда прогноз перестаёт пересекать порог, событие снимается
+func TestEngineApply(t *testing.T) {
+	db := &fakeAlertsDB{}
+	engine := NewEngine(repository.New(db), zap.NewNop())
+	rule := repository.AlertRule{ID: 1, CityID: 7, Field: "temp", Operator: OperatorLT, Threshold: 255, LookaheadHours: 24}
+
+	cold := []openweather.Forecast{forecastAt(testNow.Add(3*time.Hour), 250)}
+	colder := []openweather.Forecast{forecastAt(testNow.Add(6*time.Hour), 245)}
+	warm := []openweather.Forecast{forecastAt(testNow.Add(3*time.Hour), 270)}
+
+	steps := []struct {
+		name      string
+		forecasts []openweather.Forecast
+		wantOpen  bool
+		wantTotal int
+	}{
+		{name: "clear", forecasts: warm, wantOpen: false, wantTotal: 0},
+		{name: "crossed", forecasts: cold, wantOpen: true, wantTotal: 1},
+		{name: "still crossed", forecasts: colder, wantOpen: true, wantTotal: 1},
+		{name: "cleared", forecasts: warm, wantOpen: false, wantTotal: 1},
+		{name: "crossed again", forecasts: cold, wantOpen: true, wantTotal: 2},
+	}
+
+	for _, step := range steps {
+		engine.apply(context.Background(), rule, step.forecasts, testNow)
+
+		if db.open != step.wantOpen || len(db.events) != step.wantTotal {
+			t.Fatalf("%s: open %v, events %d, want open %v, events %d", step.name, db.open, len(db.events), step.wantOpen, step.wantTotal)
+		}
+	}
+
+	// событие хранит запись прогноза, на которой правило сработало
+	first := db.events[0]
+	if first.ForecastDate != cold[0].Date || first.Value != 250 || first.CityID != 7 {
+		t.Errorf("first event %+v", first)
+	}
+}
+
+// fakeAlertsDB события одного правила в памяти, повторяет поведение ResolveAlert и TriggerAlert:
+// новое событие не записывается, пока открыто предыдущее
+type fakeAlertsDB struct {
+	repository.DBTX
+	events []repository.TriggerAlertParams
+	open   bool
+}
+
+func (db *fakeAlertsDB) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	switch {
+	case strings.HasPrefix(query, "-- name: TriggerAlert"):
+		if db.open {
+			return fakeResult(0), nil
+		}
+		db.open = true
+		db.events = append(db.events, repository.TriggerAlertParams{
+			RuleID:       args[0].(int32),
+			CityID:       args[1].(int32),
+			ForecastDate: args[2].(int64),
+			Value:        args[3].(float64),
+		})
+		return fakeResult(1), nil
+	case strings.HasPrefix(query, "-- name: ResolveAlert"):
+		if !db.open {
+			return fakeResult(0), nil
+		}
+		db.open = false
+		return fakeResult(1), nil
+	default:
+		panic("unexpected query: " + query)
+	}
+}
+
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return 0, nil }
+
+func (r fakeResult) RowsAffected() (int64, error) { return int64(r), nil }
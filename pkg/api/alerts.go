@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/alerts"
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// ограничения на правило и список событий
+const (
+	defaultLookaheadHours = 24
+	// прогноз загружается на 5 дней вперёд
+	maxLookaheadHours  = 120
+	defaultAlertEvents = 100
+	maxAlertEvents     = 1000
+)
+
+// AlertRule правило оповещения, порог в системе единиц units
+type AlertRule struct {
+	ID             int32     `json:"id"`
+	CityID         int32     `json:"city_id"`
+	Field          string    `json:"field"`
+	Operator       string    `json:"operator"`
+	Threshold      float64   `json:"threshold"`
+	Units          Units     `json:"units"`
+	LookaheadHours int32     `json:"lookahead_hours"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// тело POST /alerts/rules, порог в системе единиц из параметра units
+type alertRuleRequest struct {
+	CityID         int32    `json:"city_id"`
+	Field          string   `json:"field"`
+	Operator       string   `json:"operator"`
+	Threshold      *float64 `json:"threshold"`
+	LookaheadHours int32    `json:"lookahead_hours"`
+}
+
+// AlertEvent сработавшее оповещение, открытое пока прогноз пересекает порог правила,
+// ForecastDate и Value - самая сильная запись прогноза на момент срабатывания
+type AlertEvent struct {
+	ID             int64      `json:"id"`
+	RuleID         int32      `json:"rule_id"`
+	CityID         int32      `json:"city_id"`
+	Field          string     `json:"field"`
+	Operator       string     `json:"operator"`
+	Threshold      float64    `json:"threshold"`
+	LookaheadHours int32      `json:"lookahead_hours"`
+	Units          Units      `json:"units"`
+	ForecastDate   time.Time  `json:"forecast_date"`
+	Value          float64    `json:"value"`
+	Active         bool       `json:"active"`
+	TriggeredAt    time.Time  `json:"triggered_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+var errBadAlertRule = errors.New("bad alert rule")
+
+// RuleEvaluator проверяет новое правило по уже загруженному прогнозу, например *alerts.Engine
+type RuleEvaluator interface {
+	EvaluateRule(ctx context.Context, rule repository.AlertRule)
+}
+
+// Alerts обрабатывает GET /alerts?city_id=&active=true&limit=, события от новых к старым
+func (a *API) Alerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be get")
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	cityID, ok := optionalCityID(w, r)
+	if !ok {
+		return
+	}
+
+	params := repository.AlertEventsParams{
+		CityID:     cityID,
+		MaxResults: defaultAlertEvents,
+	}
+	if value := r.FormValue("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "active should be true or false")
+			return
+		}
+		params.Active = active
+	}
+	if value := r.FormValue("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAlertEvents {
+			ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong limit: %q", value), fmt.Sprintf("limit should be from 1 to %d", maxAlertEvents))
+			return
+		}
+		params.MaxResults = int32(limit)
+	}
+
+	rows, err := a.repo.AlertEvents(r.Context(), params)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get alerts")
+		return
+	}
+
+	events := make([]AlertEvent, 0, len(rows))
+	for _, row := range rows {
+		event := AlertEvent{
+			ID:             row.ID,
+			RuleID:         row.RuleID,
+			CityID:         row.CityID,
+			Field:          row.Field,
+			Operator:       row.Operator,
+			Threshold:      alertValue(units, row.Field, row.Threshold),
+			LookaheadHours: row.LookaheadHours,
+			Units:          units,
+			ForecastDate:   time.Unix(row.ForecastDate, 0).UTC(),
+			Value:          alertValue(units, row.Field, row.Value),
+			Active:         !row.ResolvedAt.Valid,
+			TriggeredAt:    row.TriggeredAt,
+		}
+		if row.ResolvedAt.Valid {
+			event.ResolvedAt = &row.ResolvedAt.Time
+		}
+		events = append(events, event)
+	}
+
+	responseJSON(w, r, http.StatusOK, events)
+}
+
+// AlertRules обрабатывает GET /alerts/rules?city_id= и POST /alerts/rules с телом
+// {"city_id": 1, "field": "temp", "operator": "lt", "threshold": -20, "lookahead_hours": 24}
+func (a *API) AlertRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		units, ok := a.units(w, r)
+		if !ok {
+			return
+		}
+
+		cityID, ok := optionalCityID(w, r)
+		if !ok {
+			return
+		}
+
+		rows, err := a.repo.AlertRules(r.Context(), cityID)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't get alert rules")
+			return
+		}
+
+		rules := make([]AlertRule, 0, len(rows))
+		for _, row := range rows {
+			rules = append(rules, alertRuleInfo(row, units))
+		}
+
+		responseJSON(w, r, http.StatusOK, rules)
+	case http.MethodPost:
+		var req alertRuleRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "can't decode request body")
+			return
+		}
+
+		// units читается после тела, что бы разбор формы не прочитал тело запроса
+		units, ok := a.units(w, r)
+		if !ok {
+			return
+		}
+
+		params, err := newAlertRuleParams(req, units)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, fmt.Sprintf("field, operator (lt, lte, gt, gte) and threshold required, lookahead_hours from 1 to %d", maxLookaheadHours))
+			return
+		}
+
+		// правило по несуществующему городу - 404, а не ошибка внешнего ключа
+		_, err = a.repo.City(r.Context(), params.CityID)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+			return
+		}
+
+		rule, err := a.repo.CreateAlertRule(r.Context(), params)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't create alert rule")
+			return
+		}
+
+		// правило проверяется сразу, иначе событие появилось бы только после следующего обновления города
+		a.rules.EvaluateRule(r.Context(), rule)
+
+		responseJSON(w, r, http.StatusCreated, alertRuleInfo(rule, units))
+	default:
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be get or post")
+	}
+}
+
+// AlertRule обрабатывает DELETE /alerts/rules/{id}, события по правилу удаляются вместе с ним
+func (a *API) AlertRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be delete")
+		return
+	}
+
+	ruleID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/alerts/rules/"), 10, 32)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong rule id")
+		return
+	}
+
+	deleted, err := a.repo.DeleteAlertRule(r.Context(), int32(ruleID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't delete alert rule")
+		return
+	}
+	if deleted == 0 {
+		ErrorJSON(w, r, http.StatusNotFound, ErrNotFound, "rule not found")
+		return
+	}
+
+	NoContent(w, r)
+}
+
+// порог из запроса переводится в единицы БД, в которых хранится прогноз
+func newAlertRuleParams(req alertRuleRequest, units Units) (repository.CreateAlertRuleParams, error) {
+	kind, ok := alerts.Fields[req.Field]
+	if !ok {
+		return repository.CreateAlertRuleParams{}, fmt.Errorf("%w: unknown field %q", errBadAlertRule, req.Field)
+	}
+	if !alerts.ValidOperator(req.Operator) {
+		return repository.CreateAlertRuleParams{}, fmt.Errorf("%w: unknown operator %q", errBadAlertRule, req.Operator)
+	}
+	if req.Threshold == nil {
+		return repository.CreateAlertRuleParams{}, fmt.Errorf("%w: threshold required", errBadAlertRule)
+	}
+	if req.LookaheadHours == 0 {
+		req.LookaheadHours = defaultLookaheadHours
+	}
+	if req.LookaheadHours < 1 || req.LookaheadHours > maxLookaheadHours {
+		return repository.CreateAlertRuleParams{}, fmt.Errorf("%w: lookahead_hours %d", errBadAlertRule, req.LookaheadHours)
+	}
+
+	threshold := *req.Threshold
+	switch kind {
+	case alerts.KindTemperature:
+		threshold = units.FromTemp(threshold)
+	case alerts.KindSpeed:
+		threshold = units.FromSpeed(threshold)
+	}
+
+	return repository.CreateAlertRuleParams{
+		CityID:         req.CityID,
+		Field:          req.Field,
+		Operator:       req.Operator,
+		Threshold:      threshold,
+		LookaheadHours: req.LookaheadHours,
+	}, nil
+}
+
+func alertRuleInfo(rule repository.AlertRule, units Units) AlertRule {
+	return AlertRule{
+		ID:             rule.ID,
+		CityID:         rule.CityID,
+		Field:          rule.Field,
+		Operator:       rule.Operator,
+		Threshold:      alertValue(units, rule.Field, rule.Threshold),
+		Units:          units,
+		LookaheadHours: rule.LookaheadHours,
+		CreatedAt:      rule.CreatedAt,
+	}
+}
+
+// значение поля прогноза из единиц БД в систему единиц units
+func alertValue(units Units, field string, v float64) float64 {
+	switch alerts.Fields[field] {
+	case alerts.KindTemperature:
+		return units.Temp(v)
+	case alerts.KindSpeed:
+		return units.Speed(v)
+	default:
+		return v
+	}
+}
+
+// необязательный фильтр по городу, 0 - все города
+func optionalCityID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	value := r.FormValue("city_id")
+	if value == "" {
+		return 0, true
+	}
+
+	cityID, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+		return 0, false
+	}
+
+	return int32(cityID), true
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+// порог правила хранится в единицах БД: кельвинах и м/с
+func TestNewAlertRuleParams(t *testing.T) {
+	threshold := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name          string
+		req           alertRuleRequest
+		units         Units
+		wantThreshold float64
+		wantLookahead int32
+		wantErr       bool
+	}{
+		{
+			name:          "metric temperature",
+			req:           alertRuleRequest{Field: "temp", Operator: "lt", Threshold: threshold(-20)},
+			units:         UnitsMetric,
+			wantThreshold: 253.15,
+			wantLookahead: defaultLookaheadHours,
+		},
+		{
+			name:          "imperial temperature",
+			req:           alertRuleRequest{Field: "feels_like", Operator: "lt", Threshold: threshold(-4)},
+			units:         UnitsImperial,
+			wantThreshold: 253.15,
+			wantLookahead: defaultLookaheadHours,
+		},
+		{
+			name:          "standard temperature",
+			req:           alertRuleRequest{Field: "temp_max", Operator: "gt", Threshold: threshold(303.15), LookaheadHours: 48},
+			units:         UnitsStandard,
+			wantThreshold: 303.15,
+			wantLookahead: 48,
+		},
+		{
+			name:          "imperial wind speed",
+			req:           alertRuleRequest{Field: "wind_gust", Operator: "gte", Threshold: threshold(22.37)},
+			units:         UnitsImperial,
+			wantThreshold: 10,
+			wantLookahead: defaultLookaheadHours,
+		},
+		{
+			name:          "plain field is not converted",
+			req:           alertRuleRequest{Field: "humidity", Operator: "gt", Threshold: threshold(90)},
+			units:         UnitsImperial,
+			wantThreshold: 90,
+			wantLookahead: defaultLookaheadHours,
+		},
+		{
+			name:    "unknown field",
+			req:     alertRuleRequest{Field: "snow", Operator: "gt", Threshold: threshold(1)},
+			units:   UnitsMetric,
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			req:     alertRuleRequest{Field: "temp", Operator: "eq", Threshold: threshold(1)},
+			units:   UnitsMetric,
+			wantErr: true,
+		},
+		{
+			name:    "no threshold",
+			req:     alertRuleRequest{Field: "temp", Operator: "lt"},
+			units:   UnitsMetric,
+			wantErr: true,
+		},
+		{
+			name:    "lookahead beyond forecast",
+			req:     alertRuleRequest{Field: "temp", Operator: "lt", Threshold: threshold(0), LookaheadHours: maxLookaheadHours + 1},
+			units:   UnitsMetric,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := newAlertRuleParams(tt.req, tt.units)
+			if tt.wantErr {
+				if !errors.Is(err, errBadAlertRule) {
+					t.Errorf("got %v, want %v", err, errBadAlertRule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if params.Threshold != tt.wantThreshold || params.LookaheadHours != tt.wantLookahead {
+				t.Errorf("got threshold %v, lookahead %d, want %v, %d", params.Threshold, params.LookaheadHours, tt.wantThreshold, tt.wantLookahead)
+			}
+		})
+	}
+}
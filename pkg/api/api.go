@@ -1,26 +1,54 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/Ser9unin/WeatherForecast/pkg/cache"
 	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
 	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
 	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
 	"go.uber.org/zap"
 )
 
+// Config настройки API
+type Config struct {
+	// система единиц, если в запросе не указан параметр units
+	DefaultUnits Units
+	// запросы без ключа API отклоняются
+	AuthEnabled bool
+	// лимит запросов одного клиента по умолчанию и отдельные лимиты маршрутов
+	RateLimit       ratelimit.Rate
+	RouteRateLimits map[string]ratelimit.Rate
+	// прокси, от которых адрес клиента берётся из X-Forwarded-For
+	TrustedProxies []*net.IPNet
+}
+
 type API struct {
 	repo   *repository.Queries
+	cities CityManager
+	cache  *cache.ForecastCache
+	points *cache.PointForecasts
+	rules  RuleEvaluator
+	cfg    Config
 	logger *zap.Logger
+	routes []string
 }
 
-func NewAPI(db *repository.Queries, logger *zap.Logger) API {
+func NewAPI(db *repository.Queries, cities CityManager, fcCache *cache.ForecastCache, points *cache.PointForecasts, rules RuleEvaluator, cfg Config, logger *zap.Logger) API {
 	return API{
 		repo:   db,
+		cities: cities,
+		cache:  fcCache,
+		points: points,
+		rules:  rules,
+		cfg:    cfg,
 		logger: logger,
 	}
 }
@@ -28,19 +56,121 @@ func NewAPI(db *repository.Queries, logger *zap.Logger) API {
 func (a *API) NewRouter() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/get_cities_list", middleware.Logger(a.Cities))
-	mux.HandleFunc("/get_short_forecast", middleware.Logger(a.ShortFC))
-	mux.HandleFunc("/get_full_forecast", middleware.Logger(a.FullFcastByTime))
+	// ресурсы городов и прогнозов, ответы в snake_case
+	a.route(mux, "/v1/cities", a.V1Cities)
+	a.route(mux, "/v1/cities/", a.V1City)
+
+	// устаревшие маршруты работают как раньше, в заголовках ссылка на замену из /v1
+	a.legacyRoute(mux, "/get_cities_list", a.Cities, func(*http.Request) string { return "/v1/cities" })
+	a.legacyRoute(mux, "/get_short_forecast", a.ShortFC, v1CityPath("/forecast", "units"))
+	a.legacyRoute(mux, "/get_full_forecast", a.FullFcastByTime, v1CityPath("/forecast/at", "date", "units"))
+	a.route(mux, "/get_forecast_history", a.FcastHistory)
+	a.route(mux, "/get_daily_forecast", a.DailyFcast)
+
+	// краткий или полный прогноз сразу по нескольким городам
+	a.route(mux, "/forecasts", a.Forecasts)
+
+	// прогноз по произвольным координатам напрямую от источника
+	a.route(mux, "/forecast", a.PointForecast)
+
+	// управление списком городов, по которым загружается прогноз,
+	// добавление, изменение и удаление только с ключом администратора
+	a.managedRoute(mux, "/cities", a.AddCity)
+	a.managedRoute(mux, "/cities/", a.City)
+
+	// правила оповещений по прогнозу и сработавшие оповещения,
+	// создание и удаление правил только с ключом администратора
+	a.route(mux, "/alerts", a.Alerts)
+	a.managedRoute(mux, "/alerts/rules", a.AlertRules)
+	a.managedRoute(mux, "/alerts/rules/", a.AlertRule)
+
+	// управление ключами API, только с ключом администратора
+	a.handle(mux, "/admin/keys", middleware.Logger(a.Admin(a.validate(a.APIKeys))))
+	a.handle(mux, "/admin/keys/", middleware.Logger(a.Admin(a.validate(a.RevokeAPIKey))))
+
+	// метрики тоже только с ключом администратора, Prometheus передаёт его в Authorization: Bearer
+	a.handle(mux, "/metrics", a.Admin(a.Metrics))
+	a.handle(mux, "/openapi.json", http.HandlerFunc(a.OpenAPI))
 
 	return mux
 }
 
+// route регистрирует маршрут API: сначала ограничивается частота запросов с адреса клиента,
+// затем запрос проверяет ключ и учитывается в квотах ключа, поэтому отклонённые ограничителем запросы
+// не доходят до БД и не расходуют квоту, и параметры проверяются по openapi.json
+func (a *API) route(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	a.handle(mux, pattern, middleware.Logger(a.limit(pattern, a.Auth, a.validate(handler))))
+}
+
+// legacyRoute как route, но каждый ответ, в том числе с ошибкой, помечен заголовком Deprecation
+func (a *API) legacyRoute(mux *http.ServeMux, pattern string, handler http.HandlerFunc, successor func(r *http.Request) string) {
+	a.handle(mux, pattern, middleware.Logger(deprecated(successor, a.limit(pattern, a.Auth, a.validate(handler)))))
+}
+
+// managedRoute как route, но запросы, изменяющие данные (все методы кроме GET и HEAD),
+// проходят только с ключом администратора независимо от AUTH_ENABLED
+func (a *API) managedRoute(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	a.handle(mux, pattern, middleware.Logger(a.limit(pattern, a.AdminWrites, a.validate(handler))))
+}
+
+func (a *API) handle(mux *http.ServeMux, pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+	a.routes = append(a.routes, pattern)
+}
+
+var metricsHandler = metrics.Handler()
+
+// Metrics отдаёт метрики в формате Prometheus
+func (a *API) Metrics(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// Routes маршруты, зарегистрированные в NewRouter
+func (a *API) Routes() []string {
+	return a.routes
+}
+
+// limit ограничивает частоту запросов клиента к маршруту, у каждого маршрута свои счётчики.
+// До проверки ключа auth запросы считаются по адресу клиента, поэтому перебор ключей не доходит до БД,
+// после проверки ещё раз по ID найденного ключа, что бы один ключ не обходил лимит с разных адресов
+func (a *API) limit(route string, auth func(http.HandlerFunc) http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	rate, ok := a.cfg.RouteRateLimits[route]
+	if !ok {
+		rate = a.cfg.RateLimit
+	}
+
+	byAddr := middleware.RateLimit(ratelimit.NewKeyedLimiter(rate), a.clientAddr)
+	byKey := middleware.RateLimit(ratelimit.NewKeyedLimiter(rate), a.clientKey)
+
+	return byAddr(auth(byKey(next)))
+}
+
+// clientAddr адрес клиента с учётом доверенных прокси
+func (a *API) clientAddr(r *http.Request) string {
+	return "ip:" + middleware.ClientIP(r, a.cfg.TrustedProxies)
+}
+
+// clientKey ID ключа, который прошёл проверку, запросы без ключа считаются по адресу
+func (a *API) clientKey(r *http.Request) string {
+	if key, ok := KeyFromContext(r.Context()); ok {
+		return "key:" + strconv.Itoa(int(key.ID))
+	}
+
+	return a.clientAddr(r)
+}
+
 // GetCities позволяет получить список городов, по которым можно запросить прогноз погоды
 // от пользователя не требуется вводить какие-либо данные, на фронте нужна кнопка получить города,
 // которая будет обращаться к API "/get_cities_list"
 func (a *API) Cities(w http.ResponseWriter, r *http.Request) {
 
-	CheckHttpMethod(w, r)
+	if !CheckHttpMethod(w, r) {
+		return
+	}
 
 	// метод CitiesList возвращает список городов,
 	// сортировка по названию реализована в SQL запросе, в соответствии с заданием.
@@ -58,12 +188,18 @@ func (a *API) Cities(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	responseJSON(w, r, http.StatusOK, cities)
+	if notModified(w, r, citiesVersion(r, cities)) {
+		return
+	}
+
+	responseJSON(w, r, http.StatusOK, cityInfos(cities))
 }
 
 func (a *API) ShortFC(w http.ResponseWriter, r *http.Request) {
 
-	CheckHttpMethod(w, r)
+	if !CheckHttpMethod(w, r) {
+		return
+	}
 
 	// для получения краткого прогноза по городу нужно на стороне клиента
 	// обеспечить ввод или выбор города по ID,
@@ -74,35 +210,64 @@ func (a *API) ShortFC(w http.ResponseWriter, r *http.Request) {
 	}
 	a.logger.Info("", zap.Int("cityID", cityID))
 
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
 	// запрос в БД по ID города даст одну запись, // ID дальше используется что бы запросить прогноз в БД по ID
 	// данные по городу нужны что бы отдать их потом в ответе пользователю в соответствии с заданием,
 	// получение краткого прогноза для нескольких городов с одинаковым названием из разных стран не предусматривал
 	cityParamsID := int32(cityID)
 
-	// запрашиваем в БД ID координаты города
-	cityFromDB, err := a.repo.City(r.Context(), cityParamsID)
-
+	shortFcast, err := a.shortFcast(r.Context(), cityParamsID)
 	if err != nil {
 		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
 		return
 	}
-
-	// запрашиваем в БД краткий прогноз
-	shortFcastDB, err := a.repo.ShortFcastForCity(r.Context(), cityParamsID)
-	if err != nil {
-		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+	if len(shortFcast.Forecast) == 0 {
+		NoContent(w, r)
 		return
 	}
-	if len(shortFcastDB) == 0 {
-		NoContent(w, r)
+
+	if notModified(w, r, a.cityVersion(r, cityParamsID, shortFcast.City)) {
 		return
 	}
 
 	// парсим данные в структуру ShortCityFcast
-	shortForecast := parseShortFC(cityFromDB, shortFcastDB)
+	shortForecast := parseShortFC(shortFcast.City, shortFcast.Forecast, units)
+
+	// краткий прогноз не делится на записи по 3 часа, поэтому отдаётся только в JSON, на другие форматы ответ 406
+	Render(w, r, http.StatusOK, shortForecast)
+}
+
+// данные для краткого прогноза берутся из кэша, при промахе из БД
+func (a *API) shortFcast(ctx context.Context, cityID int32) (cache.ShortForecast, error) {
+	if fc, ok := a.cache.Short(cityID); ok {
+		return fc, nil
+	}
+
+	// поколение берётся до чтения из БД, если прогноз обновится во время чтения, результат не попадёт в кэш
+	generation := a.cache.Generation(cityID)
+
+	var fc cache.ShortForecast
+	var err error
+
+	// запрашиваем в БД ID координаты города
+	fc.City, err = a.repo.City(ctx, cityID)
+	if err != nil {
+		return fc, err
+	}
 
-	// формируем ответ в формате JSON
-	responseJSON(w, r, http.StatusOK, shortForecast)
+	// запрашиваем в БД краткий прогноз
+	fc.Forecast, err = a.repo.ShortFcastForCity(ctx, cityID)
+	if err != nil {
+		return fc, err
+	}
+
+	a.cache.SetShort(cityID, generation, fc)
+
+	return fc, nil
 }
 
 // Структура краткого прогноза отвечает требованию задания:
@@ -115,31 +280,46 @@ func (a *API) ShortFC(w http.ResponseWriter, r *http.Request) {
 type ShortCityFcast struct {
 	Country       string   `json:"country"`
 	CityName      string   `json:"city_name"`
-	AverageTemp   int      `json:"avg_temp"`
+	AverageTemp   float64  `json:"avg_temp"`
 	ForecastDates []string `json:"forecast_dates"`
+	Units         Units    `json:"units"`
+	// сдвиг местного времени города от UTC в секундах,
+	// даты прогноза, восход и закат указаны по местному времени
+	Timezone int32  `json:"timezone"`
+	Sunrise  string `json:"sunrise,omitempty"`
+	Sunset   string `json:"sunset,omitempty"`
 }
 
 // парсим данные из БД в структуру ShortCityFcast
-func parseShortFC(cityFromDB repository.CityRow, shortFcast []repository.ShortFcastForCityRow) ShortCityFcast {
+func parseShortFC(cityFromDB repository.CityRow, shortFcast []repository.ShortFcastForCityRow, units Units) ShortCityFcast {
 	var shortCityFcast ShortCityFcast
 
+	shortCityFcast.Units = units
 	shortCityFcast.CityName = cityFromDB.City.String
 	shortCityFcast.Country = cityFromDB.Country.String
+	shortCityFcast.Timezone = cityFromDB.Timezone
+
+	// дни считаются по местному времени города, а не сервера
+	loc := cityLocation(cityFromDB)
+	if cityFromDB.Sunrise != 0 {
+		shortCityFcast.Sunrise = time.Unix(cityFromDB.Sunrise, 0).In(loc).Format(dateLayout)
+	}
+	if cityFromDB.Sunset != 0 {
+		shortCityFcast.Sunset = time.Unix(cityFromDB.Sunset, 0).In(loc).Format(dateLayout)
+	}
 
 	// переменная dateToCheсk служит для проверки начался ли новый день в прогнозе,
 	// так будет получет только список дат, а каждое доступное в прогнозе время.
 	var dateToCheck time.Time
-	var day int
 	var avgTemp float64
 	for _, item := range shortFcast {
-		day = dateToCheck.Day()
-		itemDay := time.Unix(item.Date, 0)
+		itemDay := time.Unix(item.Date, 0).In(loc)
 
-		dateToCheck = itemDay
-		if day != itemDay.Day() {
-			date := dateToCheck.Format("2006-01-02 15:04:05")
+		if dateToCheck.IsZero() || dateToCheck.YearDay() != itemDay.YearDay() || dateToCheck.Year() != itemDay.Year() {
+			date := itemDay.Format(dateLayout)
 			shortCityFcast.ForecastDates = append(shortCityFcast.ForecastDates, date)
 		}
+		dateToCheck = itemDay
 
 		avgTemp += item.Temperature
 	}
@@ -147,19 +327,19 @@ func parseShortFC(cityFromDB repository.CityRow, shortFcast []repository.ShortFc
 	dividerInt := len(shortFcast)
 	dividerForAVG := float64(dividerInt)
 
-	avgTemp = avgTemp/dividerForAVG - 273
-	shortCityFcast.AverageTemp = int(avgTemp)
+	avgTemp = avgTemp / dividerForAVG
+	shortCityFcast.AverageTemp = units.Temp(avgTemp)
 	return shortCityFcast
 }
 
 // метод позволяет получить прогноз на конкретное время запрошенное пользователем
-// с учетом того что в базе хранится прогноз с шагом 3 часа  пользователь будет получать
-// данные по температуре средненные относительно времени его запроса,
-// остальные данные будут приняты на более позднее время,
-// предположил что нет цели усреднять все параметры типа скорости ветра, давления и т.п.
+// с учетом того что в базе хранится прогноз с шагом 3 часа все числовые параметры прогноза
+// линейно интерполируются между ближайшими записями до и после запрошенного времени
 func (a *API) FullFcastByTime(w http.ResponseWriter, r *http.Request) {
 
-	CheckHttpMethod(w, r)
+	if !CheckHttpMethod(w, r) {
+		return
+	}
 
 	// для получения полного прогноза по городу нужно на стороне клиента
 	// обеспечить ввод или выбор ID города
@@ -169,25 +349,37 @@ func (a *API) FullFcastByTime(w http.ResponseWriter, r *http.Request) {
 	}
 	a.logger.Info("", zap.Int("cityID", cityID))
 
-	date := r.FormValue("date")
-	t, err := time.ParseInLocation("2006-01-02 15:04:05", date, time.Local)
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	// время в запросе местное для города, если в нём не указан сдвиг от UTC
+	cityFromDB, err := a.city(r.Context(), int32(cityID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+	loc := cityLocation(cityFromDB)
+
+	t, err := parseRequestTime(r.FormValue("date"), loc)
 	if err != nil {
-		fmt.Println("Ошибка при разборе даты:", err)
+		ErrorJSON(w, r, http.StatusBadRequest, err, "date should be in format 2006-01-02 15:04:05 or RFC 3339")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, int32(cityID), cityFromDB)) {
 		return
 	}
-	unixDate := t.Unix()
-	fmt.Println("Запрошенная дата преобразована в ", unixDate)
 
 	cityTimeParams := repository.FullFcastByTimeParams{
 		CityID: int32(cityID),
-		Date:   unixDate,
+		Date:   t.Unix(),
 	}
 
-	// метод CityFcastOnTime усредненные данные о температуре на два фиксированных времени
-	// ближайших к запрошенному клиентом, это сделано на основе Ваших ответов на мои вопросы в ТГ
-	// полные данные о прогнозе будут на более позднее время т.к.
-	// усреднение прогноза целиком сложно реализовать, не думаю что это нужно в рамках этой задачи.
-	fcOnNearestTime, err := a.repo.FullFcastByTime(r.Context(), cityTimeParams)
+	// из БД приходят записи прогноза ближайшие к запрошенному времени до и после него,
+	// если время за пределами прогноза то только одна ближайшая запись
+	fcOnNearestTime, err := a.fullFcastByTime(r.Context(), cityTimeParams)
 	if err != nil {
 		ErrorJSON(w, r, StatusCode(err), err, "can't get full forecast")
 		return
@@ -198,45 +390,76 @@ func (a *API) FullFcastByTime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fcastOnTime, err := parseFcastOnTime(cityTimeParams.Date, fcOnNearestTime)
+	fcastOnTime, err := parseFcastOnTime(cityTimeParams.CityID, cityTimeParams.Date, loc, fcOnNearestTime, units)
 	if err != nil {
 		ErrorJSON(w, r, StatusCode(err), err, "can't encode forecast")
 		return
 	}
 
-	responseJSON(w, r, http.StatusOK, fcastOnTime)
+	Render(w, r, http.StatusOK, fcastOnTime)
+}
+
+// данные для полного прогноза берутся из кэша, при промахе из БД. Кэш хранит записи по 3-часовому интервалу,
+// поэтому из БД они запрашиваются на начало интервала: так в кэш попадают записи для любого времени внутри него
+func (a *API) fullFcastByTime(ctx context.Context, params repository.FullFcastByTimeParams) ([]repository.FullFcastByTimeRow, error) {
+	key := cache.NewFullKey(params.CityID, params.Date)
+	if fc, ok := a.cache.Full(key); ok {
+		return fc, nil
+	}
+
+	generation := a.cache.Generation(params.CityID)
+
+	fc, err := a.repo.FullFcastByTime(ctx, repository.FullFcastByTimeParams{
+		CityID: key.CityID,
+		Date:   key.Date,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.cache.SetFull(key, generation, fc)
+
+	return fc, nil
 }
 
 type FcastOnTime struct {
 	Date        time.Time
-	Temperature int
+	Temperature float64
 	Forecast    openweather.Forecast
+	Units       Units
+	// true если прогноз интерполирован между двумя записями,
+	// false если запрошенное время совпало с записью или вышло за пределы прогноза
+	Interpolated bool
+
+	cityID int32
 }
 
-func parseFcastOnTime(date int64, fcOnNearestTime []repository.FullFcastByTimeRow) (FcastOnTime, error) {
-	var fcastOnTime FcastOnTime
+func parseFcastOnTime(cityID int32, date int64, loc *time.Location, fcOnNearestTime []repository.FullFcastByTimeRow, units Units) (FcastOnTime, error) {
+	fcastOnTime := FcastOnTime{cityID: cityID}
 
-	fcastOnTime.Date = time.Unix(date, 0)
-	err := json.Unmarshal([]byte(fcOnNearestTime[0].Weather), &fcastOnTime.Forecast)
-	if err != nil {
-		return fcastOnTime, err
-	}
+	fcastOnTime.Date = time.Unix(date, 0).In(loc)
+	fcastOnTime.Units = units
 
-	// так как из БД приходит два значения ближайших по модулю,
-	// то может возникнуть ситуация, что они оба либо раньше во времени чем запрошенная дата, либо позже
-	// сервис отдаёт данные на 00:00, 03:00, 06:00 и т.д. причем первое значение может оказаться в будущем
-	// относительно времени, когда сервер обновил данные о погоде
-	// например данные обновились в 01:00, в прогнозе ближайшие данные будут на 03:00 и 06:00
-	// клиент запросил прогноз на 02:00,
-	nearestTemp := fcOnNearestTime[0].Temperature
-	secondTemp := fcOnNearestTime[1].Temperature
-	fcNearestTimeUnix := fcOnNearestTime[0].Date
+	forecasts := make([]openweather.Forecast, 0, len(fcOnNearestTime))
+	for _, item := range fcOnNearestTime {
+		var fc openweather.Forecast
+		err := json.Unmarshal([]byte(item.Weather), &fc)
+		if err != nil {
+			return fcastOnTime, err
+		}
+		forecasts = append(forecasts, fc)
+	}
 
-	if date < fcNearestTimeUnix || date > fcNearestTimeUnix {
-		fcastOnTime.Temperature = int(nearestTemp) - 273
-	} else {
-		fcastOnTime.Temperature = int((nearestTemp+secondTemp)/2) - 273
+	// сервис отдаёт данные на 00:00, 03:00, 06:00 и т.д., если запрошенное время между записями,
+	// то прогноз интерполируется, иначе отдаётся ближайшая запись как есть
+	forecast := forecasts[0]
+	if len(forecasts) > 1 && date > forecasts[0].Date {
+		forecast = interpolateForecast(forecasts[0], forecasts[1], date)
+		fcastOnTime.Interpolated = true
 	}
 
+	fcastOnTime.Forecast = units.Forecast(forecast)
+	fcastOnTime.Temperature = fcastOnTime.Forecast.Temp
+
 	return fcastOnTime, nil
 }
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+	"go.uber.org/zap"
+)
+
+const (
+	// заголовок и параметр запроса, в которых передаётся ключ API
+	apiKeyHeader = "X-API-Key"
+	apiKeyParam  = middleware.APIKeyParam
+	// Prometheus передаёт ключ только так: authorization.credentials в scrape_configs
+	bearerScheme = "Bearer"
+
+	apiKeyPrefix = "wf_"
+	// длина видимой части ключа, по которой ключ можно узнать в списке
+	apiKeyPrefixLen = len(apiKeyPrefix) + 8
+)
+
+var (
+	ErrNoAPIKey      = errors.New("api key required")
+	ErrBadAPIKey     = errors.New("api key is invalid or revoked")
+	ErrNotAdmin      = errors.New("admin api key required")
+	ErrQuotaExceeded = errors.New("api key quota exceeded")
+)
+
+type ctxKey int
+
+const apiKeyCtx ctxKey = iota
+
+// KeyFromContext возвращает ключ API, с которым пришёл запрос, если запрос прошёл проверку ключа
+func KeyFromContext(ctx context.Context) (repository.ApiKey, bool) {
+	key, ok := ctx.Value(apiKeyCtx).(repository.ApiKey)
+	return key, ok
+}
+
+// Auth проверяет ключ API из заголовка X-API-Key или параметра api_key и учитывает запрос в квотах ключа,
+// при выключенной проверке (AUTH_ENABLED=false) запросы без ключа проходят,
+// а запросы с ключом всё равно проверяются и учитываются
+func (a *API) Auth(next http.HandlerFunc) http.HandlerFunc {
+	return a.authenticate(next, false)
+}
+
+// Admin пропускает только запросы с ключом администратора независимо от AUTH_ENABLED
+func (a *API) Admin(next http.HandlerFunc) http.HandlerFunc {
+	return a.authenticate(next, true)
+}
+
+// AdminWrites чтение проверяет как Auth, а запросы, изменяющие данные, пропускает только с ключом администратора
+func (a *API) AdminWrites(next http.HandlerFunc) http.HandlerFunc {
+	read, write := a.Auth(next), a.Admin(next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			read(w, r)
+			return
+		}
+		write(w, r)
+	}
+}
+
+func (a *API) authenticate(next http.HandlerFunc, admin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := apiKeyValue(r)
+		if value == "" {
+			if !admin && !a.cfg.AuthEnabled {
+				next(w, r)
+				return
+			}
+			ErrorJSON(w, r, http.StatusUnauthorized, ErrNoAPIKey, fmt.Sprintf("pass api key in %s header, Authorization: %s header or %s parameter", apiKeyHeader, bearerScheme, apiKeyParam))
+			return
+		}
+
+		key, err := a.repo.APIKeyByHash(r.Context(), hashAPIKey(value))
+		if errors.Is(err, sql.ErrNoRows) {
+			ErrorJSON(w, r, http.StatusUnauthorized, ErrBadAPIKey, "can't authenticate request")
+			return
+		}
+		if err != nil {
+			ErrorJSON(w, r, http.StatusInternalServerError, err, "can't authenticate request")
+			return
+		}
+
+		if admin && !key.IsAdmin {
+			ErrorJSON(w, r, http.StatusForbidden, ErrNotAdmin, "can't authenticate request")
+			return
+		}
+
+		now := time.Now().UTC()
+		usage, err := a.repo.UseAPIKey(r.Context(), repository.UseAPIKeyParams{
+			KeyID: key.ID,
+			Day:   UsageDay(now),
+		})
+		if err != nil {
+			ErrorJSON(w, r, http.StatusInternalServerError, err, "can't count api key usage")
+			return
+		}
+
+		// в счётчики попадают и отклонённые запросы, поэтому сравниваем строго больше
+		switch {
+		case key.DailyQuota > 0 && usage.DailyRequests > int64(key.DailyQuota):
+			a.quotaExceeded(w, r, key, "daily", nextDay(now).Sub(now))
+			return
+		case key.MonthlyQuota > 0 && usage.MonthlyRequests > int64(key.MonthlyQuota):
+			a.quotaExceeded(w, r, key, "monthly", nextMonth(now).Sub(now))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyCtx, key)))
+	}
+}
+
+func (a *API) quotaExceeded(w http.ResponseWriter, r *http.Request, key repository.ApiKey, period string, retryAfter time.Duration) {
+	a.logger.Warn("превышена квота ключа API",
+		zap.Int32("key_id", key.ID),
+		zap.String("prefix", key.Prefix),
+		zap.String("period", period))
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	ErrorJSON(w, r, http.StatusTooManyRequests, ErrQuotaExceeded, period+" quota exceeded")
+}
+
+// UsageDay день учёта запросов по UTC, время полдень, что бы приведение к DATE в БД не зависело от часового пояса сессии
+func UsageDay(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, time.UTC)
+}
+
+func nextDay(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// NewAPIKeyParams параметры нового ключа, квота 0 значит без ограничения
+type NewAPIKeyParams struct {
+	Name         string `json:"name"`
+	IsAdmin      bool   `json:"is_admin"`
+	DailyQuota   int32  `json:"daily_quota"`
+	MonthlyQuota int32  `json:"monthly_quota"`
+}
+
+// CreateAPIKey создаёт ключ, в БД сохраняется только его хэш, поэтому сам ключ возвращается один раз
+func CreateAPIKey(ctx context.Context, repo *repository.Queries, params NewAPIKeyParams) (string, repository.ApiKey, error) {
+	if params.Name == "" {
+		return "", repository.ApiKey{}, errors.New("name required")
+	}
+	if params.DailyQuota < 0 || params.MonthlyQuota < 0 {
+		return "", repository.ApiKey{}, errors.New("quota can't be negative")
+	}
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", repository.ApiKey{}, err
+	}
+	value := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key, err := repo.CreateAPIKey(ctx, repository.CreateAPIKeyParams{
+		Name:         params.Name,
+		Prefix:       value[:apiKeyPrefixLen],
+		KeyHash:      hashAPIKey(value),
+		IsAdmin:      params.IsAdmin,
+		DailyQuota:   params.DailyQuota,
+		MonthlyQuota: params.MonthlyQuota,
+	})
+	if err != nil {
+		return "", repository.ApiKey{}, err
+	}
+
+	return value, key, nil
+}
+
+// apiKeyValue ключ из заголовка X-API-Key, заголовка Authorization: Bearer или параметра api_key,
+// пустая строка если ключа нет
+func apiKeyValue(r *http.Request) string {
+	value := r.Header.Get(apiKeyHeader)
+	if value == "" {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if ok && strings.EqualFold(scheme, bearerScheme) {
+			value = strings.TrimSpace(token)
+		}
+	}
+	if value == "" {
+		value = r.URL.Query().Get(apiKeyParam)
+	}
+
+	return value
+}
+
+func hashAPIKey(value string) []byte {
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "no key", target: "/metrics"},
+		{name: "header", target: "/metrics", headers: map[string]string{"X-API-Key": "wf_header"}, want: "wf_header"},
+		{name: "bearer", target: "/metrics", headers: map[string]string{"Authorization": "Bearer wf_bearer"}, want: "wf_bearer"},
+		{name: "bearer scheme is case-insensitive", target: "/metrics", headers: map[string]string{"Authorization": "bearer wf_bearer"}, want: "wf_bearer"},
+		{name: "basic is not a key", target: "/metrics", headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+		{name: "parameter", target: "/metrics?api_key=wf_param", want: "wf_param"},
+		{
+			name:    "header before bearer and parameter",
+			target:  "/metrics?api_key=wf_param",
+			headers: map[string]string{"X-API-Key": "wf_header", "Authorization": "Bearer wf_bearer"},
+			want:    "wf_header",
+		},
+		{
+			name:    "bearer before parameter",
+			target:  "/metrics?api_key=wf_param",
+			headers: map[string]string{"Authorization": "Bearer wf_bearer"},
+			want:    "wf_bearer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			got := apiKeyValue(r)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// ограничение на количество городов в одном запросе
+const maxBatchCities = 100
+
+// виды прогноза в пакетном запросе
+const (
+	batchShort = "short"
+	batchFull  = "full"
+)
+
+// тело POST /forecasts, те же параметры что и в GET /forecasts
+type batchRequest struct {
+	CityIDs []int32 `json:"city_ids"`
+	Type    string  `json:"type"`
+	Date    string  `json:"date"`
+}
+
+// BatchForecast прогнозы по нескольким городам, ошибки по отдельным городам
+// отдаются в самих записях и не прерывают весь запрос
+type BatchForecast struct {
+	Type      string              `json:"type"`
+	Units     Units               `json:"units"`
+	Forecasts []BatchCityForecast `json:"forecasts"`
+}
+
+type BatchCityForecast struct {
+	CityID int32           `json:"city_id"`
+	Status int             `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Short  *ShortCityFcast `json:"short,omitempty"`
+	Full   *FcastOnTime    `json:"full,omitempty"`
+}
+
+var (
+	errBatchCityNotFound = errors.New("city not found")
+	errNoForecast        = errors.New("no forecast for city")
+	errBadDate           = errors.New("bad date")
+)
+
+// Forecasts обрабатывает GET /forecasts?city_id=1,2,3&type=short|full&date=...
+// и POST /forecasts с телом {"city_ids": [1, 2, 3], "type": "full", "date": "..."},
+// прогноз по всем городам читается из БД одним запросом
+func (a *API) Forecasts(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		ids, err := parseCityIDs(r.FormValue("city_id"))
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "city_id should be comma separated list of ids")
+			return
+		}
+		req = batchRequest{
+			CityIDs: ids,
+			Type:    r.FormValue("type"),
+			Date:    r.FormValue("date"),
+		}
+	case http.MethodPost:
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "can't decode request body")
+			return
+		}
+	default:
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be get or post")
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	req.CityIDs = uniqueCityIDs(req.CityIDs)
+	if len(req.CityIDs) == 0 || len(req.CityIDs) > maxBatchCities {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("got %d cities", len(req.CityIDs)), fmt.Sprintf("from 1 to %d cities required", maxBatchCities))
+		return
+	}
+
+	var batch BatchForecast
+	var err error
+
+	switch req.Type {
+	case "", batchShort:
+		batch, err = a.batchShort(r, req.CityIDs, units)
+	case batchFull:
+		batch, err = a.batchFull(r, req.CityIDs, req.Date, units)
+		if errors.Is(err, errBadDate) {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "date should be in format 2006-01-02 15:04:05 or RFC 3339")
+			return
+		}
+	default:
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("unknown type: %s", req.Type), "type should be short or full")
+		return
+	}
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get forecasts")
+		return
+	}
+
+	Render(w, r, http.StatusOK, batch)
+}
+
+// краткий прогноз по городам, строки из БД отсортированы по городу и времени
+func (a *API) batchShort(r *http.Request, cityIDs []int32, units Units) (BatchForecast, error) {
+	rows, err := a.repo.ShortFcastForCities(r.Context(), cityIDs)
+	if err != nil {
+		return BatchForecast{}, err
+	}
+
+	cities := make(map[int32]repository.CityRow, len(cityIDs))
+	forecasts := make(map[int32][]repository.ShortFcastForCityRow, len(cityIDs))
+	for _, row := range rows {
+		cities[row.ID] = repository.CityRow{
+			City:      row.City,
+			Latitude:  row.Latitude,
+			Longitude: row.Longitude,
+			Country:   row.Country,
+			Timezone:  row.Timezone,
+			Sunrise:   row.Sunrise,
+			Sunset:    row.Sunset,
+		}
+
+		// город без прогноза приходит одной строкой без даты
+		if !row.Date.Valid {
+			continue
+		}
+		forecasts[row.ID] = append(forecasts[row.ID], repository.ShortFcastForCityRow{
+			CityID:      row.ID,
+			Date:        row.Date.Int64,
+			Temperature: row.Temperature.Float64,
+		})
+	}
+
+	batch := BatchForecast{
+		Type:      batchShort,
+		Units:     units,
+		Forecasts: make([]BatchCityForecast, 0, len(cityIDs)),
+	}
+	for _, id := range cityIDs {
+		city, ok := cities[id]
+		if !ok {
+			batch.Forecasts = append(batch.Forecasts, batchError(id, http.StatusNotFound, errBatchCityNotFound))
+			continue
+		}
+		if len(forecasts[id]) == 0 {
+			batch.Forecasts = append(batch.Forecasts, batchError(id, http.StatusNotFound, errNoForecast))
+			continue
+		}
+
+		short := parseShortFC(city, forecasts[id], units)
+		batch.Forecasts = append(batch.Forecasts, BatchCityForecast{
+			CityID: id,
+			Status: http.StatusOK,
+			Short:  &short,
+		})
+	}
+
+	return batch, nil
+}
+
+// полный прогноз по городам на одно время, время без сдвига от UTC местное для каждого города
+func (a *API) batchFull(r *http.Request, cityIDs []int32, date string, units Units) (BatchForecast, error) {
+	params := repository.FullFcastForCitiesParams{
+		CityIds: cityIDs,
+	}
+
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		// местное время читаем как UTC, сдвиг на часовой пояс города делается в БД
+		t, err = time.Parse(dateLayout, date)
+		if err != nil {
+			return BatchForecast{}, fmt.Errorf("%w: %s", errBadDate, err)
+		}
+		params.Local = true
+	}
+	params.Date = t.Unix()
+
+	rows, err := a.repo.FullFcastForCities(r.Context(), params)
+	if err != nil {
+		return BatchForecast{}, err
+	}
+
+	cities := make(map[int32]repository.CityRow, len(cityIDs))
+	forecasts := make(map[int32][]repository.FullFcastByTimeRow, len(cityIDs))
+	for _, row := range rows {
+		cities[row.ID] = repository.CityRow{
+			City:      row.City,
+			Latitude:  row.Latitude,
+			Longitude: row.Longitude,
+			Country:   row.Country,
+			Timezone:  row.Timezone,
+			Sunrise:   row.Sunrise,
+			Sunset:    row.Sunset,
+		}
+
+		if !row.Date.Valid {
+			continue
+		}
+		forecasts[row.ID] = append(forecasts[row.ID], repository.FullFcastByTimeRow{
+			Date:    row.Date.Int64,
+			Weather: row.Weather,
+		})
+	}
+
+	batch := BatchForecast{
+		Type:      batchFull,
+		Units:     units,
+		Forecasts: make([]BatchCityForecast, 0, len(cityIDs)),
+	}
+	for _, id := range cityIDs {
+		city, ok := cities[id]
+		if !ok {
+			batch.Forecasts = append(batch.Forecasts, batchError(id, http.StatusNotFound, errBatchCityNotFound))
+			continue
+		}
+		if len(forecasts[id]) == 0 {
+			batch.Forecasts = append(batch.Forecasts, batchError(id, http.StatusNotFound, errNoForecast))
+			continue
+		}
+
+		cityDate := params.Date
+		if params.Local {
+			cityDate -= int64(city.Timezone)
+		}
+
+		full, err := parseFcastOnTime(id, cityDate, cityLocation(city), forecasts[id], units)
+		if err != nil {
+			batch.Forecasts = append(batch.Forecasts, batchError(id, http.StatusInternalServerError, err))
+			continue
+		}
+
+		batch.Forecasts = append(batch.Forecasts, BatchCityForecast{
+			CityID: id,
+			Status: http.StatusOK,
+			Full:   &full,
+		})
+	}
+
+	return batch, nil
+}
+
+func batchError(cityID int32, status int, err error) BatchCityForecast {
+	return BatchCityForecast{
+		CityID: cityID,
+		Status: status,
+		Error:  err.Error(),
+	}
+}
+
+// список ID через запятую: "1,2,3"
+func parseCityIDs(value string) ([]int32, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, ",")
+	ids := make([]int32, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int32(id))
+	}
+
+	return ids, nil
+}
+
+// убираем повторы, порядок городов в ответе как в запросе
+func uniqueCityIDs(ids []int32) []int32 {
+	seen := make(map[int32]bool, len(ids))
+	unique := make([]int32, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	return unique
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// длина строки iCalendar в байтах без CRLF, длинные строки переносятся (RFC 5545, 3.1)
+const icsLineLimit = 75
+
+// ForecastCalendar обрабатывает GET /cities/{id}/forecast.ics: календарь RFC 5545 с событием на весь день
+// на каждый день прогноза. UID события зависит только от города и дня, поэтому при обновлении подписки
+// календарь заменяет события, а не добавляет новые
+func (a *API) ForecastCalendar(w http.ResponseWriter, r *http.Request, cityID int32) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	cityFromDB, err := a.city(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, cityID, cityFromDB)) {
+		return
+	}
+
+	days, err := a.repo.DailyFcastForCity(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get daily forecast")
+		return
+	}
+
+	stamp := time.Now()
+	if cityFromDB.ForecastUpdatedAt.Valid {
+		stamp = cityFromDB.ForecastUpdatedAt.Time
+	}
+
+	writeResponse(w, http.StatusOK, "text/calendar; charset=utf-8", forecastCalendar(cityID, cityFromDB, days, units, stamp))
+}
+
+// forecastCalendar календарь без событий, если прогноз ещё не загружен, что бы подписка не ломалась
+func forecastCalendar(cityID int32, city repository.CityRow, days []repository.DailyFcastForCityRow, units Units, stamp time.Time) []byte {
+	var b bytes.Buffer
+	dtstamp := stamp.UTC().Format("20060102T150405Z")
+	refresh := "PT" + strconv.Itoa(int(openweather.RefreshInterval.Minutes())) + "M"
+	name := city.City.String + " forecast"
+
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//WeatherForecast//Daily forecast//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "METHOD:PUBLISH")
+	writeICSLine(&b, "NAME:"+escapeICSText(name))
+	writeICSLine(&b, "X-WR-CALNAME:"+escapeICSText(name))
+	// как часто календарю перечитывать подписку: прогноз по городу обновляется с тем же интервалом
+	writeICSLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:"+refresh)
+	writeICSLine(&b, "X-PUBLISHED-TTL:"+refresh)
+
+	for _, day := range days {
+		start, err := time.Parse(time.DateOnly, day.Day)
+		if err != nil {
+			continue
+		}
+
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, fmt.Sprintf("UID:%s-city-%d@weatherforecast", start.Format("20060102"), cityID))
+		writeICSLine(&b, "DTSTAMP:"+dtstamp)
+		writeICSLine(&b, "LAST-MODIFIED:"+dtstamp)
+		writeICSLine(&b, "DTSTART;VALUE=DATE:"+start.Format("20060102"))
+		writeICSLine(&b, "DTEND;VALUE=DATE:"+start.AddDate(0, 0, 1).Format("20060102"))
+		writeICSLine(&b, "SUMMARY:"+escapeICSText(daySummary(city.City.String, day, units)))
+		writeICSLine(&b, "DESCRIPTION:"+escapeICSText(dayDescription(day, units)))
+		// событие не занимает время в календаре
+		writeICSLine(&b, "TRANSP:TRANSPARENT")
+		writeICSLine(&b, "END:VEVENT")
+	}
+
+	writeICSLine(&b, "END:VCALENDAR")
+
+	return b.Bytes()
+}
+
+// "Moscow: 12–19°C, light rain"
+func daySummary(city string, day repository.DailyFcastForCityRow, units Units) string {
+	summary := fmt.Sprintf("%s: %s–%s%s", city,
+		formatDegrees(units.Temp(day.TempMin)), formatDegrees(units.Temp(day.TempMax)), units.tempSymbol())
+	if day.Description != "" {
+		summary += ", " + day.Description
+	}
+
+	return summary
+}
+
+func dayDescription(day repository.DailyFcastForCityRow, units Units) string {
+	symbol := units.tempSymbol()
+
+	lines := []string{
+		fmt.Sprintf("Temperature %s..%s%s, mean %s%s",
+			formatDegrees(units.Temp(day.TempMin)), formatDegrees(units.Temp(day.TempMax)), symbol,
+			formatDegrees(units.Temp(day.TempMean)), symbol),
+		fmt.Sprintf("Precipitation %s mm, probability %d%%", formatFloat(round(day.Precipitation)), int(math.Round(day.MaxPop*100))),
+		fmt.Sprintf("Wind gusts up to %s %s", formatFloat(units.Speed(day.MaxGust)), units.speedSymbol()),
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// температура целыми градусами, без "-0"
+func formatDegrees(v float64) string {
+	return strconv.Itoa(int(math.Round(v)))
+}
+
+func (u Units) tempSymbol() string {
+	switch u {
+	case UnitsMetric:
+		return "°C"
+	case UnitsImperial:
+		return "°F"
+	default:
+		return " K"
+	}
+}
+
+func (u Units) speedSymbol() string {
+	if u == UnitsImperial {
+		return "mph"
+	}
+
+	return "m/s"
+}
+
+// экранирование значения TEXT (RFC 5545, 3.3.11)
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine пишет строку с CRLF, длинная строка переносится на следующие строки с пробелом в начале,
+// перенос не разрывает символы UTF-8
+func writeICSLine(b *bytes.Buffer, line string) {
+	limit := icsLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// пробел в начале продолжения входит в длину строки
+		limit = icsLineLimit - 1
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+func TestWriteICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{name: "short", line: "VERSION:2.0", want: "VERSION:2.0\r\n"},
+		{name: "exactly 75 octets", line: strings.Repeat("a", 75), want: strings.Repeat("a", 75) + "\r\n"},
+		{name: "76 octets", line: strings.Repeat("a", 76), want: strings.Repeat("a", 75) + "\r\n a\r\n"},
+		{
+			name: "continuation counts the leading space",
+			line: strings.Repeat("a", 75+74+1),
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n",
+		},
+		{
+			// двухбайтовый символ занимал бы 75-й и 76-й байты, поэтому переносится целиком
+			name: "multibyte character on the limit",
+			line: strings.Repeat("a", 74) + "ж",
+			want: strings.Repeat("a", 74) + "\r\n ж\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeICSLine(&b, tt.line)
+
+			if b.String() != tt.want {
+				t.Errorf("got %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+// длинная строка кириллицей: каждая строка не длиннее 75 байт, не разрывает символы и склеивается обратно
+func TestWriteICSLineMultibyte(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("Москва: небольшой снег, ", 10)
+
+	var b bytes.Buffer
+	writeICSLine(&b, line)
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("line of %d octets is not folded", len(line))
+	}
+	for i, l := range lines {
+		if len(l) > icsLineLimit {
+			t.Errorf("line %d: %d octets", i, len(l))
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line %d splits a character: %q", i, l)
+		}
+		if i > 0 && !strings.HasPrefix(l, " ") {
+			t.Errorf("line %d: continuation without a leading space", i)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(strings.TrimSuffix(b.String(), "\r\n"), "\r\n ", "")
+	if unfolded != line {
+		t.Errorf("unfolded %q, want %q", unfolded, line)
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Moscow: 12–19°C", want: "Moscow: 12–19°C"},
+		{in: "Moscow: 12–19°C, light rain", want: `Moscow: 12–19°C\, light rain`},
+		{in: "a;b", want: `a\;b`},
+		{in: `C:\tmp`, want: `C:\\tmp`},
+		{in: "line 1\nline 2", want: `line 1\nline 2`},
+		{in: "line 1\r\nline 2", want: `line 1\nline 2`},
+	}
+
+	for _, tt := range tests {
+		got := escapeICSText(tt.in)
+		if got != tt.want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// UID зависит только от города и дня: календарь, обновлённый в другое время или в других единицах,
+// заменяет те же события
+func TestForecastCalendarUID(t *testing.T) {
+	city := repository.CityRow{City: sql.NullString{String: "Moscow", Valid: true}}
+	days := []repository.DailyFcastForCityRow{
+		{Day: "2024-03-30", TempMin: 270, TempMax: 280, Description: "light rain"},
+		{Day: "2024-03-31", TempMin: 271, TempMax: 282},
+	}
+	want := []string{
+		"UID:20240330-city-7@weatherforecast",
+		"UID:20240331-city-7@weatherforecast",
+	}
+
+	first := forecastCalendar(7, city, days, UnitsMetric, time.Date(2024, 3, 30, 9, 0, 0, 0, time.UTC))
+	second := forecastCalendar(7, city, days, UnitsImperial, time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC))
+
+	for _, calendar := range [][]byte{first, second} {
+		var uids []string
+		for _, line := range strings.Split(string(calendar), "\r\n") {
+			if strings.HasPrefix(line, "UID:") {
+				uids = append(uids, line)
+			}
+		}
+		if strings.Join(uids, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", uids, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// CityManager управляет списком городов, по которым загружается прогноз,
+// изменения сразу применяются к циклу обновления прогнозов без перезапуска сервера,
+// NextRefresh время следующего обновления прогноза по городу для Cache-Control
+type CityManager interface {
+	AddCityByName(ctx context.Context, name string) ([]repository.City, error)
+	AddCity(ctx context.Context, city openweather.CityGeoData) (repository.City, error)
+	RemoveCity(ctx context.Context, cityID int32) error
+	SetCityDisabled(ctx context.Context, cityID int32, disabled bool) (repository.City, error)
+	NextRefresh(cityID int32) (time.Time, bool)
+}
+
+// CityInfo город в ответах /get_cities_list и /cities в прежнем формате,
+// время последней записи прогноза служебное и отдаётся только в Last-Modified
+type CityInfo struct {
+	ID        int32
+	City      sql.NullString
+	Latitude  float64
+	Longitude float64
+	Country   sql.NullString
+	Disabled  bool
+	Timezone  int32
+	Sunrise   int64
+	Sunset    int64
+}
+
+func cityInfo(city repository.City) CityInfo {
+	return CityInfo{
+		ID:        city.ID,
+		City:      city.City,
+		Latitude:  city.Latitude,
+		Longitude: city.Longitude,
+		Country:   city.Country,
+		Disabled:  city.Disabled,
+		Timezone:  city.Timezone,
+		Sunrise:   city.Sunrise,
+		Sunset:    city.Sunset,
+	}
+}
+
+func cityInfos(cities []repository.City) []CityInfo {
+	infos := make([]CityInfo, 0, len(cities))
+	for _, city := range cities {
+		infos = append(infos, cityInfo(city))
+	}
+
+	return infos
+}
+
+// запрос на добавление города: либо название, которое будет найдено через геокодер,
+// либо координаты, название и страна в этом случае необязательны
+type newCityRequest struct {
+	Name      string   `json:"name"`
+	Country   string   `json:"country"`
+	Latitude  *float64 `json:"lat"`
+	Longitude *float64 `json:"lon"`
+}
+
+type cityUpdateRequest struct {
+	Disabled *bool `json:"disabled"`
+}
+
+// AddCity обрабатывает POST /cities
+func (a *API) AddCity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be post")
+		return
+	}
+
+	var req newCityRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "can't decode request body")
+		return
+	}
+
+	switch {
+	case req.Latitude != nil && req.Longitude != nil:
+		city, err := a.cities.AddCity(r.Context(), openweather.CityGeoData{
+			Name:      req.Name,
+			Latitude:  *req.Latitude,
+			Longitude: *req.Longitude,
+			Country:   req.Country,
+		})
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't add city")
+			return
+		}
+
+		responseJSON(w, r, http.StatusCreated, []CityInfo{cityInfo(city)})
+	case req.Name != "":
+		cities, err := a.cities.AddCityByName(r.Context(), req.Name)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't add city")
+			return
+		}
+
+		responseJSON(w, r, http.StatusCreated, cityInfos(cities))
+	default:
+		ErrorJSON(w, r, http.StatusBadRequest, errors.New("name or lat and lon required"), "can't add city")
+	}
+}
+
+// City обрабатывает DELETE /cities/{id} и PATCH /cities/{id} с телом {"disabled": true},
+// GET /cities/nearest передаётся в NearestCities, GET /cities/{id}/forecast.ics в ForecastCalendar
+func (a *API) City(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/cities/")
+	if path == "nearest" {
+		a.NearestCities(w, r)
+		return
+	}
+
+	if id, ok := strings.CutSuffix(path, "/forecast.ics"); ok {
+		cityID, err := strconv.ParseInt(id, 10, 32)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+			return
+		}
+
+		a.ForecastCalendar(w, r, int32(cityID))
+		return
+	}
+
+	cityID, err := strconv.Atoi(path)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		err = a.cities.RemoveCity(r.Context(), int32(cityID))
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't remove city")
+			return
+		}
+
+		NoContent(w, r)
+	case http.MethodPatch:
+		var req cityUpdateRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "can't decode request body")
+			return
+		}
+
+		if req.Disabled == nil {
+			ErrorJSON(w, r, http.StatusBadRequest, errors.New("disabled required"), "can't update city")
+			return
+		}
+
+		city, err := a.cities.SetCityDisabled(r.Context(), int32(cityID), *req.Disabled)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't update city")
+			return
+		}
+
+		responseJSON(w, r, http.StatusOK, cityInfo(city))
+	default:
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be delete or patch")
+	}
+}
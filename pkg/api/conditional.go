@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// version версия данных ответа для условных запросов, пустой etag значит, что версия неизвестна
+type version struct {
+	etag         string
+	lastModified time.Time
+	maxAge       time.Duration
+}
+
+// newVersion ETag зависит от пути, параметров запроса кроме ключа API, заголовка Accept и частей версии данных parts
+func newVersion(r *http.Request, lastModified time.Time, maxAge time.Duration, parts ...string) version {
+	query := r.URL.Query()
+	query.Del(apiKeyParam)
+
+	h := fnv.New64a()
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	// Encode сортирует параметры, порядок параметров в запросе на ETag не влияет
+	h.Write([]byte(query.Encode()))
+	// один и тот же ресурс может отдаваться в разных форматах
+	h.Write([]byte{0})
+	h.Write([]byte(r.Header.Get("Accept")))
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+
+	return version{
+		etag:         fmt.Sprintf(`W/"%x"`, h.Sum64()),
+		lastModified: lastModified,
+		maxAge:       maxAge,
+	}
+}
+
+// cityVersion версия прогноза по городу: меняется при каждой записи прогноза в БД,
+// ответ можно кэшировать до следующего запланированного обновления города
+func (a *API) cityVersion(r *http.Request, cityID int32, city repository.CityRow) version {
+	if !city.ForecastUpdatedAt.Valid {
+		return version{}
+	}
+	updatedAt := city.ForecastUpdatedAt.Time
+
+	var maxAge time.Duration
+	if next, ok := a.cities.NextRefresh(cityID); ok {
+		maxAge = max(time.Until(next), 0)
+	}
+
+	return newVersion(r, updatedAt, maxAge,
+		strconv.Itoa(int(cityID)),
+		strconv.FormatInt(updatedAt.UnixNano(), 10),
+		strconv.FormatBool(city.Disabled))
+}
+
+// citiesVersion версия списка городов, меняется при добавлении, удалении, отключении города и записи прогноза,
+// время следующего изменения заранее неизвестно, поэтому клиент проверяет версию при каждом запросе
+func citiesVersion(r *http.Request, cities []repository.City) version {
+	var lastModified time.Time
+	parts := make([]string, 0, len(cities))
+	for _, city := range cities {
+		parts = append(parts, fmt.Sprintf("%d:%t:%d", city.ID, city.Disabled, city.ForecastUpdatedAt.Time.UnixNano()))
+		if city.ForecastUpdatedAt.Time.After(lastModified) {
+			lastModified = city.ForecastUpdatedAt.Time
+		}
+	}
+
+	return newVersion(r, lastModified, 0, parts...)
+}
+
+// notModified выставляет ETag, Last-Modified и Cache-Control и отвечает 304, если у клиента та же версия,
+// вызывается до формирования тела ответа. Ответ зависит от ключа API и формата, поэтому хранить его можно
+// только в кэше клиента, Vary выставляется и в ответе 304
+func notModified(w http.ResponseWriter, r *http.Request, v version) bool {
+	if v.etag == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("ETag", v.etag)
+	header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(v.maxAge.Seconds())))
+	vary(header, "Accept", apiKeyHeader)
+	if !v.lastModified.IsZero() {
+		header.Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match важнее If-Modified-Since, если есть оба
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatch(match, v.etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || v.lastModified.IsZero() || v.lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// vary добавляет в Vary заголовки запроса, которых там ещё нет
+func vary(header http.Header, names ...string) {
+	present := make(map[string]bool)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			present[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	for _, name := range names {
+		if !present[http.CanonicalHeaderKey(name)] {
+			header.Add("Vary", name)
+			present[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// сравнение ETag из If-None-Match, слабое сравнение: W/ не учитывается
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ответ зависит от ключа, поэтому кэшируется только у клиента, Vary есть и в 304
+func TestNotModifiedHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/cities/1/forecast", nil)
+	v := newVersion(r, time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC), 10*time.Minute, "1")
+
+	w := httptest.NewRecorder()
+	if notModified(w, r, v) {
+		t.Fatal("request without validators got 304")
+	}
+	Render(w, r, http.StatusOK, ShortForecastV1{})
+
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=600" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if got := strings.Join(w.Header().Values("Vary"), ", "); got != "Accept, X-API-Key" {
+		t.Errorf("Vary = %q", got)
+	}
+
+	r.Header.Set("If-None-Match", v.etag)
+	w = httptest.NewRecorder()
+	if !notModified(w, r, v) {
+		t.Fatal("request with the same ETag didn't get 304")
+	}
+	if w.Code != http.StatusNotModified {
+		t.Errorf("got %d, want 304", w.Code)
+	}
+	if got := strings.Join(w.Header().Values("Vary"), ", "); got != "Accept, X-API-Key" {
+		t.Errorf("304 Vary = %q", got)
+	}
+}
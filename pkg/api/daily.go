@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// DailyCityFcast прогноз по календарным дням
+type DailyCityFcast struct {
+	Country  string       `json:"country"`
+	CityName string       `json:"city_name"`
+	Units    Units        `json:"units"`
+	Days     []DailyFcast `json:"days"`
+}
+
+type DailyFcast struct {
+	Date     string  `json:"date"`
+	TempMin  float64 `json:"temp_min"`
+	TempMax  float64 `json:"temp_max"`
+	TempMean float64 `json:"temp_mean"`
+	// сумма дождя и снега за день в мм
+	Precipitation float64 `json:"precipitation"`
+	MaxWindGust   float64 `json:"max_wind_gust"`
+	MaxPop        float64 `json:"max_pop"`
+	Condition     string  `json:"condition"`
+	Description   string  `json:"description"`
+	Icon          string  `json:"icon"`
+}
+
+// метод отдаёт сводку по каждому дню прогноза: минимальная, максимальная и средняя температура,
+// сумма осадков, максимальные порывы ветра и вероятность осадков, преобладающая погода
+func (a *API) DailyFcast(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	cityID, err := strconv.Atoi(r.FormValue("city_id"))
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	cityFromDB, err := a.city(r.Context(), int32(cityID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, int32(cityID), cityFromDB)) {
+		return
+	}
+
+	days, err := a.repo.DailyFcastForCity(r.Context(), int32(cityID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get daily forecast")
+		return
+	}
+
+	if len(days) == 0 {
+		NoContent(w, r)
+		return
+	}
+
+	Render(w, r, http.StatusOK, parseDailyFcast(cityFromDB, days, units))
+}
+
+func parseDailyFcast(cityFromDB repository.CityRow, days []repository.DailyFcastForCityRow, units Units) DailyCityFcast {
+	dailyFcast := DailyCityFcast{
+		Country:  cityFromDB.Country.String,
+		CityName: cityFromDB.City.String,
+		Units:    units,
+		Days:     make([]DailyFcast, 0, len(days)),
+	}
+
+	for _, day := range days {
+		dailyFcast.Days = append(dailyFcast.Days, DailyFcast{
+			Date:          day.Day,
+			TempMin:       units.Temp(day.TempMin),
+			TempMax:       units.Temp(day.TempMax),
+			TempMean:      units.Temp(day.TempMean),
+			Precipitation: round(day.Precipitation),
+			MaxWindGust:   units.Speed(day.MaxGust),
+			MaxPop:        day.MaxPop,
+			Condition:     day.Condition,
+			Description:   day.Description,
+			Icon:          day.Icon,
+		})
+	}
+
+	return dailyFcast
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Renderer кодирует ответ в один из форматов, формат выбирается по параметру format или заголовку Accept
+type Renderer interface {
+	ContentType() string
+	// Supports false, если ответ v нельзя представить в этом формате
+	Supports(v interface{}) bool
+	Render(w io.Writer, v interface{}) error
+}
+
+// параметр запроса с форматом ответа, важнее заголовка Accept
+const formatParam = "format"
+
+var errUnknownFormat = errors.New("unknown format")
+
+var jsonFormat Renderer = jsonRenderer{}
+
+// renderers форматы по имени из параметра format, mediaTypes те же форматы по типу из Accept
+var (
+	renderers  = make(map[string]Renderer)
+	mediaTypes = make(map[string]Renderer)
+)
+
+func init() {
+	registerRenderer("json", jsonFormat, "application/json")
+	registerRenderer("csv", csvRenderer{}, "text/csv")
+	registerRenderer("ndjson", ndjsonRenderer{}, "application/x-ndjson")
+	registerRenderer("protobuf", protobufRenderer{}, "application/x-protobuf", "application/protobuf")
+}
+
+func registerRenderer(format string, renderer Renderer, types ...string) {
+	renderers[format] = renderer
+	for _, mediaType := range types {
+		mediaTypes[mediaType] = renderer
+	}
+}
+
+// Render отдаёт ответ в формате, который выбрал клиент, ошибки всегда отдаются в JSON.
+// Неизвестный format или формат, в котором нельзя представить ответ, отклоняется с 406,
+// если в Accept нет ни одного известного формата, ответ отдаётся в JSON
+func Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	vary(w.Header(), "Accept")
+
+	renderer, err := negotiate(r)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusNotAcceptable, err, "format should be json, csv, ndjson or protobuf")
+		return
+	}
+	if !renderer.Supports(v) {
+		mediaType, _, _ := strings.Cut(renderer.ContentType(), ";")
+		ErrorJSON(w, r, http.StatusNotAcceptable, fmt.Errorf("%s is not available", mediaType), "only json is available for this resource")
+		return
+	}
+
+	if renderer == jsonFormat {
+		responseJSON(w, r, status, v)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err = renderer.Render(buf, v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, status, renderer.ContentType(), buf.Bytes())
+}
+
+func negotiate(r *http.Request) (Renderer, error) {
+	if format := r.URL.Query().Get(formatParam); format != "" {
+		renderer, ok := renderers[format]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownFormat, format)
+		}
+		return renderer, nil
+	}
+
+	for _, mediaType := range acceptedTypes(r.Header.Get("Accept")) {
+		if renderer, ok := mediaTypes[mediaType]; ok {
+			return renderer, nil
+		}
+		if mediaType == "*/*" || mediaType == "application/*" {
+			return jsonFormat, nil
+		}
+	}
+
+	return jsonFormat, nil
+}
+
+// типы из Accept по убыванию q, типы с q=0 клиент не принимает
+func acceptedTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+
+	var types []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		types = append(types, accepted{mediaType: mediaType, q: q})
+	}
+
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].q > types[j].q
+	})
+
+	result := make([]string, 0, len(types))
+	for _, item := range types {
+		result = append(result, item.mediaType)
+	}
+
+	return result
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) ContentType() string { return "application/json; charset=utf-8" }
+
+func (jsonRenderer) Supports(v interface{}) bool { return true }
+
+func (jsonRenderer) Render(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// forecastSlots записи прогноза из ответа, если ответ можно разбить на записи
+func forecastSlots(v interface{}) ([]ForecastSlot, bool) {
+	s, ok := v.(slotter)
+	if !ok {
+		return nil, false
+	}
+
+	return s.forecastSlots()
+}
+
+func supportsSlots(v interface{}) bool {
+	_, ok := forecastSlots(v)
+	return ok
+}
+
+// csvRenderer одна строка на запись прогноза, первая строка - названия колонок
+type csvRenderer struct{}
+
+func (csvRenderer) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvRenderer) Supports(v interface{}) bool { return supportsSlots(v) }
+
+func (csvRenderer) Render(w io.Writer, v interface{}) error {
+	slots, _ := forecastSlots(v)
+
+	cw := csv.NewWriter(w)
+
+	header := make([]string, 0, len(slotColumns))
+	for _, column := range slotColumns {
+		header = append(header, column.name)
+	}
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	record := make([]string, len(slotColumns))
+	for _, slot := range slots {
+		for i, column := range slotColumns {
+			record[i] = column.value(slot)
+		}
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// колонки CSV называются так же, как поля ForecastSlot в JSON
+var slotColumns = []struct {
+	name  string
+	value func(s ForecastSlot) string
+}{
+	{"city_id", func(s ForecastSlot) string { return strconv.Itoa(int(s.CityID)) }},
+	{"time", func(s ForecastSlot) string { return s.Time.Format(time.RFC3339) }},
+	{"issued_at", func(s ForecastSlot) string {
+		if s.IssuedAt == nil {
+			return ""
+		}
+		return s.IssuedAt.Format(time.RFC3339)
+	}},
+	{"interpolated", func(s ForecastSlot) string { return strconv.FormatBool(s.Interpolated) }},
+	{"units", func(s ForecastSlot) string { return string(s.Units) }},
+	{"temp", func(s ForecastSlot) string { return formatFloat(s.Temp) }},
+	{"feels_like", func(s ForecastSlot) string { return formatFloat(s.FeelsLike) }},
+	{"temp_min", func(s ForecastSlot) string { return formatFloat(s.TempMin) }},
+	{"temp_max", func(s ForecastSlot) string { return formatFloat(s.TempMax) }},
+	{"pressure", func(s ForecastSlot) string { return strconv.Itoa(s.Pressure) }},
+	{"sea_level", func(s ForecastSlot) string { return strconv.Itoa(s.SeaLevel) }},
+	{"grnd_level", func(s ForecastSlot) string { return strconv.Itoa(s.GrndLevel) }},
+	{"humidity", func(s ForecastSlot) string { return strconv.Itoa(s.Humidity) }},
+	{"temp_kf", func(s ForecastSlot) string { return formatFloat(s.TempKf) }},
+	{"weather_id", func(s ForecastSlot) string { return strconv.Itoa(s.WeatherID) }},
+	{"weather_main", func(s ForecastSlot) string { return s.WeatherMain }},
+	{"weather_description", func(s ForecastSlot) string { return s.WeatherDescription }},
+	{"weather_icon", func(s ForecastSlot) string { return s.WeatherIcon }},
+	{"clouds", func(s ForecastSlot) string { return strconv.Itoa(s.Clouds) }},
+	{"wind_speed", func(s ForecastSlot) string { return formatFloat(s.WindSpeed) }},
+	{"wind_deg", func(s ForecastSlot) string { return strconv.Itoa(s.WindDeg) }},
+	{"wind_gust", func(s ForecastSlot) string { return formatFloat(s.WindGust) }},
+	{"visibility", func(s ForecastSlot) string { return strconv.Itoa(s.Visibility) }},
+	{"pop", func(s ForecastSlot) string { return formatFloat(s.Pop) }},
+	{"rain_3h", func(s ForecastSlot) string { return formatFloat(s.Rain3h) }},
+	{"pod", func(s ForecastSlot) string { return s.Pod }},
+	{"dt_txt", func(s ForecastSlot) string { return s.DtTxt }},
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ndjsonRenderer одна запись прогноза в строке, каждая строка сразу отправляется клиенту,
+// поэтому длинный период можно читать, не дожидаясь конца ответа
+type ndjsonRenderer struct{}
+
+func (ndjsonRenderer) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonRenderer) Supports(v interface{}) bool { return supportsSlots(v) }
+
+func (ndjsonRenderer) Render(w io.Writer, v interface{}) error {
+	slots, _ := forecastSlots(v)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for _, slot := range slots {
+		err := enc.Encode(slot)
+		if err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	return nil
+}
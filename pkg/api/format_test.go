@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ответы, которые не делятся на записи прогноза, отдаются только в JSON
+func TestRenderNotAcceptable(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   int
+	}{
+		{name: "json", target: "/?format=json", want: http.StatusOK},
+		{name: "default", target: "/", want: http.StatusOK},
+		{name: "csv", target: "/?format=csv", want: http.StatusNotAcceptable},
+		{name: "ndjson", target: "/?format=ndjson", want: http.StatusNotAcceptable},
+		{name: "protobuf", target: "/?format=protobuf", want: http.StatusNotAcceptable},
+		{name: "unknown", target: "/?format=xml", want: http.StatusNotAcceptable},
+		{name: "accept protobuf", target: "/", accept: "application/x-protobuf", want: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			Render(w, r, http.StatusOK, ShortCityFcast{CityName: "Moscow"})
+
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
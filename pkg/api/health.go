@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// таймаут проверки соединения с БД и запроса свежести прогноза в /readyz
+const readyDBTimeout = 2 * time.Second
+
+// Pinger проверяет соединение с БД, например *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// IngestionStatus состояние загрузки прогнозов
+type IngestionStatus interface {
+	InitialLoadDone() bool
+}
+
+// ForecastStore время последней записи прогноза в БД, например *repository.Queries.
+// Свежесть берётся из БД, а не из памяти процесса, что бы перезапущенный экземпляр
+// или экземпляр, который сам не загружает прогноз, не считался неготовым
+type ForecastStore interface {
+	NewestForecastUpdate(ctx context.Context) (sql.NullTime, error)
+}
+
+// Health обработчики проверки живости и готовности сервиса для оркестратора
+type Health struct {
+	db             Pinger
+	ingestion      IngestionStatus
+	forecasts      ForecastStore
+	maxForecastAge time.Duration
+}
+
+func NewHealth(db Pinger, ingestion IngestionStatus, forecasts ForecastStore, maxForecastAge time.Duration) *Health {
+	return &Health{
+		db:             db,
+		ingestion:      ingestion,
+		forecasts:      forecasts,
+		maxForecastAge: maxForecastAge,
+	}
+}
+
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// Readiness результат всех проверок, Status ok только если все проверки ok
+type Readiness struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// время выполнения проверки или возраст данных
+	Duration string `json:"duration,omitempty"`
+}
+
+// Healthz отвечает 200, пока процесс работает и обрабатывает запросы
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	responseJSON(w, r, http.StatusOK, JSONMap{"status": checkOK})
+}
+
+// Readyz проверяет соединение с БД, завершение первичной загрузки прогнозов и свежесть последнего прогноза,
+// если хотя бы одна проверка не прошла ответ 503
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	readiness := Readiness{
+		Status: checkOK,
+		Checks: map[string]Check{
+			"db":                 h.checkDB(r.Context()),
+			"initial_load":       h.checkInitialLoad(),
+			"forecast_freshness": h.checkFreshness(r.Context(), time.Now()),
+		},
+	}
+
+	status := http.StatusOK
+	for _, check := range readiness.Checks {
+		if check.Status != checkOK {
+			readiness.Status = checkFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	responseJSON(w, r, status, readiness)
+}
+
+func (h *Health) checkDB(ctx context.Context) Check {
+	ctx, cancel := context.WithTimeout(ctx, readyDBTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.db.PingContext(ctx)
+	check := Check{
+		Status:   checkOK,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		check.Status = checkFail
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+func (h *Health) checkInitialLoad() Check {
+	if !h.ingestion.InitialLoadDone() {
+		return Check{Status: checkFail, Error: "initial forecast load is in progress"}
+	}
+
+	return Check{Status: checkOK}
+}
+
+func (h *Health) checkFreshness(ctx context.Context, now time.Time) Check {
+	ctx, cancel := context.WithTimeout(ctx, readyDBTimeout)
+	defer cancel()
+
+	lastRefresh, err := h.forecasts.NewestForecastUpdate(ctx)
+	if err != nil {
+		return Check{Status: checkFail, Error: err.Error()}
+	}
+	if !lastRefresh.Valid {
+		return Check{Status: checkFail, Error: "no forecast loaded yet"}
+	}
+
+	age := now.Sub(lastRefresh.Time).Truncate(time.Second)
+	check := Check{
+		Status:   checkOK,
+		Duration: age.String(),
+	}
+	if age > h.maxForecastAge {
+		check.Status = checkFail
+		check.Error = fmt.Sprintf("newest forecast is older than %s", h.maxForecastAge)
+	}
+
+	return check
+}
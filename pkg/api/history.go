@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// ForecastHistory история прогнозов на одно время: как менялся прогноз от загрузки к загрузке
+type ForecastHistory struct {
+	CityID    int32              `json:"city_id"`
+	Date      time.Time          `json:"date"`
+	Units     Units              `json:"units"`
+	Revisions []ForecastRevision `json:"revisions"`
+}
+
+type ForecastRevision struct {
+	IssuedAt    time.Time            `json:"issued_at"`
+	Temperature float64              `json:"temperature"`
+	Forecast    openweather.Forecast `json:"forecast"`
+}
+
+// прогноз даётся с шагом 3 часа, ревизии ищутся не дальше половины шага от запрошенного времени
+const historyMaxDistance = 90 * time.Minute
+
+// метод позволяет получить все ревизии прогноза на время, ближайшее к запрошенному,
+// в отличие от FullFcastByTime, который отдаёт только последний прогноз
+func (a *API) FcastHistory(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	cityID, err := strconv.Atoi(r.FormValue("city_id"))
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	cityFromDB, err := a.city(r.Context(), int32(cityID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+	loc := cityLocation(cityFromDB)
+
+	t, err := parseRequestTime(r.FormValue("date"), loc)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "date should be in format 2006-01-02 15:04:05 or RFC 3339")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, int32(cityID), cityFromDB)) {
+		return
+	}
+
+	revisions, err := a.repo.ForecastHistory(r.Context(), repository.ForecastHistoryParams{
+		CityID:      int32(cityID),
+		Date:        t.Unix(),
+		MaxDistance: int64(historyMaxDistance.Seconds()),
+	})
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get forecast history")
+		return
+	}
+
+	if len(revisions) == 0 {
+		ErrorJSON(w, r, http.StatusNotFound, fmt.Errorf("no forecast for %s", t.Format(time.RFC3339)), "no forecast within 90 minutes of requested time")
+		return
+	}
+
+	history, err := parseFcastHistory(int32(cityID), loc, revisions, units)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't encode forecast history")
+		return
+	}
+
+	Render(w, r, http.StatusOK, history)
+}
+
+func parseFcastHistory(cityID int32, loc *time.Location, revisions []repository.ForecastHistoryRow, units Units) (ForecastHistory, error) {
+	history := ForecastHistory{
+		CityID:    cityID,
+		Date:      time.Unix(revisions[0].Date, 0).In(loc),
+		Units:     units,
+		Revisions: make([]ForecastRevision, 0, len(revisions)),
+	}
+
+	for _, item := range revisions {
+		revision := ForecastRevision{
+			IssuedAt:    time.Unix(item.IssuedAt, 0).In(loc),
+			Temperature: units.Temp(item.Temperature),
+		}
+
+		err := json.Unmarshal(item.Weather, &revision.Forecast)
+		if err != nil {
+			return history, err
+		}
+		revision.Forecast = units.Forecast(revision.Forecast)
+
+		history.Revisions = append(history.Revisions, revision)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// interpolateForecast линейно интерполирует все числовые параметры прогноза между записями
+// before и after на время date, направление ветра интерполируется по окружности,
+// описание погоды и время суток берутся из ближайшей по времени записи
+func interpolateForecast(before, after openweather.Forecast, date int64) openweather.Forecast {
+	w := float64(date-before.Date) / float64(after.Date-before.Date)
+
+	nearest := before.ForecastData
+	if w > 0.5 {
+		nearest = after.ForecastData
+	}
+
+	b, a := before.ForecastData, after.ForecastData
+	item := nearest
+	item.Weather = append(nearest.Weather[:0:0], nearest.Weather...)
+
+	item.Dt = date
+	item.DtTxt = time.Unix(date, 0).UTC().Format("2006-01-02 15:04:05")
+
+	item.Main.Temp = lerp(b.Main.Temp, a.Main.Temp, w)
+	item.Main.FeelsLike = lerp(b.Main.FeelsLike, a.Main.FeelsLike, w)
+	item.Main.TempMin = lerp(b.Main.TempMin, a.Main.TempMin, w)
+	item.Main.TempMax = lerp(b.Main.TempMax, a.Main.TempMax, w)
+	item.Main.TempKf = lerp(b.Main.TempKf, a.Main.TempKf, w)
+	item.Main.Pressure = lerpInt(b.Main.Pressure, a.Main.Pressure, w)
+	item.Main.SeaLevel = lerpInt(b.Main.SeaLevel, a.Main.SeaLevel, w)
+	item.Main.GrndLevel = lerpInt(b.Main.GrndLevel, a.Main.GrndLevel, w)
+	item.Main.Humidity = lerpInt(b.Main.Humidity, a.Main.Humidity, w)
+
+	item.Wind.Speed = lerp(b.Wind.Speed, a.Wind.Speed, w)
+	item.Wind.Gust = lerp(b.Wind.Gust, a.Wind.Gust, w)
+	item.Wind.Deg = lerpDeg(b.Wind.Deg, a.Wind.Deg, w)
+
+	item.Clouds.All = lerpInt(b.Clouds.All, a.Clouds.All, w)
+	item.Visibility = lerpInt(b.Visibility, a.Visibility, w)
+	item.Pop = lerp(b.Pop, a.Pop, w)
+	item.Rain.ThreeH = lerp(b.Rain.ThreeH, a.Rain.ThreeH, w)
+	item.Snow.ThreeH = lerp(b.Snow.ThreeH, a.Snow.ThreeH, w)
+
+	return openweather.Forecast{
+		Temp:         item.Main.Temp,
+		Date:         date,
+		ForecastData: item,
+	}
+}
+
+func lerp(from, to, w float64) float64 {
+	return round(from + (to-from)*w)
+}
+
+func lerpInt(from, to int, w float64) int {
+	return int(math.Round(float64(from) + float64(to-from)*w))
+}
+
+// интерполяция направления по окружности: между 350° и 10° получается 0°, а не 180°
+func lerpDeg(from, to int, w float64) int {
+	fromRad := float64(from) * math.Pi / 180
+	toRad := float64(to) * math.Pi / 180
+
+	x := (1-w)*math.Cos(fromRad) + w*math.Cos(toRad)
+	y := (1-w)*math.Sin(fromRad) + w*math.Sin(toRad)
+
+	// противоположные направления посередине интервала взаимно гасятся, берём ближайшее
+	if math.Hypot(x, y) < 1e-9 {
+		if w > 0.5 {
+			return to
+		}
+		return from
+	}
+
+	deg := int(math.Round(math.Atan2(y, x) * 180 / math.Pi))
+	return (deg + 360) % 360
+}
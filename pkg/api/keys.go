@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// APIKey ключ API без секрета, с использованием за текущие день и месяц по UTC
+type APIKey struct {
+	ID              int32      `json:"id"`
+	Name            string     `json:"name"`
+	Prefix          string     `json:"prefix"`
+	IsAdmin         bool       `json:"is_admin"`
+	DailyQuota      int32      `json:"daily_quota"`
+	MonthlyQuota    int32      `json:"monthly_quota"`
+	DailyRequests   int64      `json:"daily_requests"`
+	MonthlyRequests int64      `json:"monthly_requests"`
+	CreatedAt       time.Time  `json:"created_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKey созданный ключ, Key больше нигде не отдаётся
+type NewAPIKey struct {
+	Key string `json:"key"`
+	APIKey
+}
+
+// APIKeys обрабатывает GET /admin/keys со списком ключей и POST /admin/keys с телом
+// {"name": "client", "is_admin": false, "daily_quota": 1000, "monthly_quota": 20000}
+func (a *API) APIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := a.repo.ListAPIKeys(r.Context(), UsageDay(time.Now()))
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't get api keys")
+			return
+		}
+
+		keys := make([]APIKey, 0, len(rows))
+		for _, row := range rows {
+			key := APIKey{
+				ID:              row.ID,
+				Name:            row.Name,
+				Prefix:          row.Prefix,
+				IsAdmin:         row.IsAdmin,
+				DailyQuota:      row.DailyQuota,
+				MonthlyQuota:    row.MonthlyQuota,
+				DailyRequests:   row.DailyRequests,
+				MonthlyRequests: row.MonthlyRequests,
+				CreatedAt:       row.CreatedAt,
+			}
+			if row.RevokedAt.Valid {
+				key.RevokedAt = &row.RevokedAt.Time
+			}
+			keys = append(keys, key)
+		}
+
+		responseJSON(w, r, http.StatusOK, keys)
+	case http.MethodPost:
+		var req NewAPIKeyParams
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "can't decode request body")
+			return
+		}
+
+		if req.Name == "" || req.DailyQuota < 0 || req.MonthlyQuota < 0 {
+			ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong key params: %+v", req), "name required, quotas can't be negative")
+			return
+		}
+
+		value, key, err := CreateAPIKey(r.Context(), a.repo, req)
+		if err != nil {
+			ErrorJSON(w, r, StatusCode(err), err, "can't create api key")
+			return
+		}
+
+		responseJSON(w, r, http.StatusCreated, NewAPIKey{
+			Key:    value,
+			APIKey: apiKeyInfo(key),
+		})
+	default:
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be get or post")
+	}
+}
+
+// RevokeAPIKey обрабатывает DELETE /admin/keys/{id}, ключ отзывается, но остаётся в списке вместе с историей использования
+func (a *API) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be delete")
+		return
+	}
+
+	keyID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/admin/keys/"))
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong key id")
+		return
+	}
+
+	revoked, err := a.repo.RevokeAPIKey(r.Context(), int32(keyID))
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't revoke api key")
+		return
+	}
+	if revoked == 0 {
+		ErrorJSON(w, r, http.StatusNotFound, ErrNotFound, "key not found or already revoked")
+		return
+	}
+
+	NoContent(w, r)
+}
+
+func apiKeyInfo(key repository.ApiKey) APIKey {
+	info := APIKey{
+		ID:           key.ID,
+		Name:         key.Name,
+		Prefix:       key.Prefix,
+		IsAdmin:      key.IsAdmin,
+		DailyQuota:   key.DailyQuota,
+		MonthlyQuota: key.MonthlyQuota,
+		CreatedAt:    key.CreatedAt,
+	}
+	if key.RevokedAt.Valid {
+		info.RevokedAt = &key.RevokedAt.Time
+	}
+
+	return info
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+const (
+	// средний радиус Земли, такой же как в запросе NearestCities
+	earthRadiusKm = 6371.0088
+
+	defaultNearestLimit  = 10
+	maxNearestLimit      = 100
+	defaultNearestRadius = 100.0
+	// половина длины экватора, дальше точек на сфере не бывает
+	maxNearestRadius = math.Pi * earthRadiusKm
+)
+
+// NearestCity город и расстояние до него от запрошенной точки
+type NearestCity struct {
+	ID         int32   `json:"id"`
+	City       string  `json:"city"`
+	Country    string  `json:"country"`
+	Latitude   float64 `json:"lat"`
+	Longitude  float64 `json:"lon"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// NearestCities обрабатывает GET /cities/nearest?lat=&lon=&limit=&radius_km=,
+// города отсортированы по расстоянию от точки
+func (a *API) NearestCities(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong lat: %q", r.FormValue("lat")), "lat should be from -90 to 90")
+		return
+	}
+
+	lon, err := strconv.ParseFloat(r.FormValue("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong lon: %q", r.FormValue("lon")), "lon should be from -180 to 180")
+		return
+	}
+
+	limit := defaultNearestLimit
+	if value := r.FormValue("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxNearestLimit {
+			ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong limit: %q", value), fmt.Sprintf("limit should be from 1 to %d", maxNearestLimit))
+			return
+		}
+	}
+
+	radius := defaultNearestRadius
+	if value := r.FormValue("radius_km"); value != "" {
+		radius, err = strconv.ParseFloat(value, 64)
+		if err != nil || radius <= 0 {
+			ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong radius_km: %q", value), "radius_km should be positive")
+			return
+		}
+		radius = math.Min(radius, maxNearestRadius)
+	}
+
+	params := nearestCitiesParams(lat, lon, radius)
+	params.MaxResults = int32(limit)
+
+	rows, err := a.repo.NearestCities(r.Context(), params)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get nearest cities")
+		return
+	}
+
+	cities := make([]NearestCity, 0, len(rows))
+	for _, row := range rows {
+		cities = append(cities, NearestCity{
+			ID:         row.ID,
+			City:       row.City.String,
+			Country:    row.Country.String,
+			Latitude:   row.Latitude,
+			Longitude:  row.Longitude,
+			DistanceKm: round(row.DistanceKm),
+		})
+	}
+
+	responseJSON(w, r, http.StatusOK, cities)
+}
+
+// nearestCitiesParams считает прямоугольник вокруг точки, в который попадают все точки не дальше radius,
+// если прямоугольник задевает полюс или линию перемены дат, то по долготе он не ограничивается
+func nearestCitiesParams(lat, lon, radius float64) repository.NearestCitiesParams {
+	params := repository.NearestCitiesParams{
+		Lat:      lat,
+		Lon:      lon,
+		MinLat:   -90,
+		MaxLat:   90,
+		MinLon:   -180,
+		MaxLon:   180,
+		RadiusKm: radius,
+	}
+
+	dLat := radius / earthRadiusKm * 180 / math.Pi
+	if lat-dLat <= -90 || lat+dLat >= 90 {
+		params.MinLat = math.Max(lat-dLat, -90)
+		params.MaxLat = math.Min(lat+dLat, 90)
+		return params
+	}
+	params.MinLat = lat - dLat
+	params.MaxLat = lat + dLat
+
+	// наибольшая разница долгот точек круга, когда полюс в круг не попадает: asin(sin(r) / cos(lat))
+	dLon := math.Asin(math.Sin(radius/earthRadiusKm)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+	if lon-dLon < -180 || lon+dLon > 180 {
+		return params
+	}
+	params.MinLon = lon - dLon
+	params.MaxLon = lon + dLon
+
+	return params
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// описание API в формате OpenAPI 3, по нему проверяются параметры запросов
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// часть OpenAPI, нужная для проверки параметров запроса
+type specDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]specParameter `json:"parameters"`
+		Schemas    map[string]specSchema    `json:"schemas"`
+	} `json:"components"`
+}
+
+type specOperation struct {
+	Parameters []specParameter `json:"parameters"`
+}
+
+type specParameter struct {
+	Ref      string     `json:"$ref"`
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Explode  *bool      `json:"explode"`
+	Schema   specSchema `json:"schema"`
+}
+
+type specSchema struct {
+	Ref              string        `json:"$ref"`
+	Type             string        `json:"type"`
+	Enum             []interface{} `json:"enum"`
+	Minimum          *float64      `json:"minimum"`
+	Maximum          *float64      `json:"maximum"`
+	ExclusiveMinimum bool          `json:"exclusiveMinimum"`
+	Items            *specSchema   `json:"items"`
+	MinItems         *int          `json:"minItems"`
+	MaxItems         *int          `json:"maxItems"`
+}
+
+// путь из описания, сегменты вида {id} совпадают с любым значением
+type specRoute struct {
+	path       string
+	segments   []string
+	operations map[string][]specParameter
+}
+
+// маршруты из openapi.json, загружаются один раз при старте
+var specRoutes = mustLoadSpec(openapiSpec)
+
+func mustLoadSpec(data []byte) []specRoute {
+	routes, err := loadSpec(data)
+	if err != nil {
+		panic(fmt.Sprintf("openapi.json: %s", err))
+	}
+
+	return routes
+}
+
+func loadSpec(data []byte) ([]specRoute, error) {
+	var doc specDocument
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	resolve := func(param specParameter) (specParameter, error) {
+		if param.Ref != "" {
+			name := strings.TrimPrefix(param.Ref, "#/components/parameters/")
+			ref, ok := doc.Components.Parameters[name]
+			if !ok {
+				return param, fmt.Errorf("unknown parameter %s", param.Ref)
+			}
+			param = ref
+		}
+		if param.Schema.Ref != "" {
+			name := strings.TrimPrefix(param.Schema.Ref, "#/components/schemas/")
+			ref, ok := doc.Components.Schemas[name]
+			if !ok {
+				return param, fmt.Errorf("unknown schema %s", param.Schema.Ref)
+			}
+			param.Schema = ref
+		}
+
+		return param, nil
+	}
+
+	routes := make([]specRoute, 0, len(doc.Paths))
+	for path, item := range doc.Paths {
+		route := specRoute{
+			path:       path,
+			segments:   strings.Split(strings.Trim(path, "/"), "/"),
+			operations: make(map[string][]specParameter),
+		}
+
+		// общие параметры пути действуют во всех методах
+		var common []specParameter
+		if raw, ok := item["parameters"]; ok {
+			err := json.Unmarshal(raw, &common)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+
+			var op specOperation
+			err := json.Unmarshal(raw, &op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+
+			params := make([]specParameter, 0, len(common)+len(op.Parameters))
+			for _, param := range append(append([]specParameter{}, common...), op.Parameters...) {
+				param, err := resolve(param)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+				params = append(params, param)
+			}
+			route.operations[strings.ToUpper(method)] = params
+		}
+
+		routes = append(routes, route)
+	}
+
+	// пути без переменных проверяются раньше, что бы /cities/nearest не совпадал с /cities/{id}
+	sort.Slice(routes, func(i, j int) bool {
+		return strings.Count(routes[i].path, "{") < strings.Count(routes[j].path, "{")
+	})
+
+	return routes, nil
+}
+
+func (s specRoute) match(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != len(s.segments) {
+		return false
+	}
+
+	for i, segment := range s.segments {
+		if strings.HasPrefix(segment, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findSpecRoute(path string) (specRoute, bool) {
+	for _, route := range specRoutes {
+		if route.match(path) {
+			return route, true
+		}
+	}
+
+	return specRoute{}, false
+}
+
+// OpenAPI отдаёт описание API
+func (a *API) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openapiSpec)
+}
+
+// validate проверяет параметры запроса по описанию в openapi.json, при ошибке ответ 400,
+// на пути, которых нет в описании, ответ 404, запросы с неописанным методом передаются дальше,
+// на них отвечает 405 сам обработчик
+func (a *API) validate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, ok := findSpecRoute(r.URL.Path)
+		if !ok {
+			ErrorJSON(w, r, http.StatusNotFound, ErrNotFound, "path is not described in /openapi.json")
+			return
+		}
+
+		params, ok := route.operations[r.Method]
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		err := validateQuery(params, r.URL.Query())
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "request doesn't match /openapi.json")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func validateQuery(params []specParameter, query url.Values) error {
+	for _, param := range params {
+		if param.In != "query" {
+			continue
+		}
+
+		value := query.Get(param.Name)
+		if value == "" {
+			if param.Required {
+				return fmt.Errorf("query parameter %s is required", param.Name)
+			}
+			continue
+		}
+
+		err := validateValue(param, value)
+		if err != nil {
+			return fmt.Errorf("query parameter %s: %w", param.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateValue(param specParameter, value string) error {
+	if param.Schema.Type != "array" {
+		return param.Schema.check(value)
+	}
+
+	// массив в одном параметре через запятую (style form, explode false)
+	var items []string
+	if param.Explode != nil && !*param.Explode {
+		items = strings.Split(value, ",")
+	} else {
+		items = []string{value}
+	}
+
+	if param.Schema.MinItems != nil && len(items) < *param.Schema.MinItems {
+		return fmt.Errorf("should contain at least %d items", *param.Schema.MinItems)
+	}
+	if param.Schema.MaxItems != nil && len(items) > *param.Schema.MaxItems {
+		return fmt.Errorf("should contain at most %d items", *param.Schema.MaxItems)
+	}
+
+	if param.Schema.Items == nil {
+		return nil
+	}
+	for _, item := range items {
+		err := param.Schema.Items.check(strings.TrimSpace(item))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s specSchema) check(value string) error {
+	var number float64
+	var err error
+
+	switch s.Type {
+	case "integer":
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 64)
+		number = float64(i)
+	case "number":
+		number, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not %s", value, s.Type)
+	}
+
+	if s.Type == "integer" || s.Type == "number" {
+		if s.Minimum != nil && (number < *s.Minimum || s.ExclusiveMinimum && number == *s.Minimum) {
+			return fmt.Errorf("%s should be greater than %v", value, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Errorf("%s should be less than %v", value, *s.Maximum)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, item := range s.Enum {
+			if fmt.Sprint(item) == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q should be one of %v", value, s.Enum)
+	}
+
+	return nil
+}
+
+// SpecDrift сверяет маршруты mux с путями в openapi.json: каждый путь описания должен обрабатываться mux,
+// а каждый маршрут из patterns должен быть описан, возвращает найденные расхождения.
+// Методы и параметры здесь не сверяются, их проверяет TestRoutesMatchSpec запросами к роутеру
+func SpecDrift(mux *http.ServeMux, patterns []string) []string {
+	var drift []string
+	covered := make(map[string]bool, len(patterns))
+
+	for _, route := range specRoutes {
+		path := route.path
+		for _, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") {
+				path = strings.Replace(path, segment, "1", 1)
+			}
+		}
+
+		_, pattern := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}})
+		if pattern == "" {
+			drift = append(drift, fmt.Sprintf("path %s is described in openapi.json but has no handler", route.path))
+			continue
+		}
+		covered[pattern] = true
+	}
+
+	for _, pattern := range patterns {
+		if !covered[pattern] {
+			drift = append(drift, fmt.Sprintf("route %s is not described in openapi.json", pattern))
+		}
+	}
+
+	sort.Strings(drift)
+	return drift
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/cache"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+)
+
+// PointFcast прогноз по произвольным координатам, координаты округлены до 2 знаков,
+// даты, восход и закат указаны по местному времени точки
+type PointFcast struct {
+	Latitude  float64                `json:"lat"`
+	Longitude float64                `json:"lon"`
+	Timezone  int                    `json:"timezone"`
+	Sunrise   string                 `json:"sunrise,omitempty"`
+	Sunset    string                 `json:"sunset,omitempty"`
+	Units     Units                  `json:"units"`
+	Forecasts []openweather.Forecast `json:"forecasts"`
+}
+
+// PointForecast обрабатывает GET /forecast?lat=&lon=, прогноз запрашивается у источника
+// и не сохраняется в БД, в заголовке X-Cache видно, был ли прогноз в кэше
+func (a *API) PointForecast(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong lat: %q", r.FormValue("lat")), "lat should be from -90 to 90")
+		return
+	}
+
+	lon, err := strconv.ParseFloat(r.FormValue("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("wrong lon: %q", r.FormValue("lon")), "lon should be from -180 to 180")
+		return
+	}
+
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	key := cache.NewPointKey(lat, lon)
+	fc, cached, err := a.points.Forecast(r.Context(), key)
+	var budgetErr *cache.BudgetError
+	if errors.As(err, &budgetErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(budgetErr.RetryAfter.Seconds())+1))
+		ErrorJSON(w, r, http.StatusTooManyRequests, err, "too many point forecast requests, try later")
+		return
+	}
+	if err != nil {
+		ErrorJSON(w, r, providerStatusCode(err), err, "can't get forecast from provider")
+		return
+	}
+
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+
+	Render(w, r, http.StatusOK, parsePointFcast(key, fc, units))
+}
+
+func parsePointFcast(key cache.PointKey, fc openweather.CityForecast, units Units) PointFcast {
+	pointFcast := PointFcast{
+		Timezone:  fc.Timezone,
+		Units:     units,
+		Forecasts: make([]openweather.Forecast, 0, len(fc.List)),
+	}
+	pointFcast.Latitude, pointFcast.Longitude = key.Coords()
+
+	loc := time.FixedZone("", fc.Timezone)
+	if fc.Sunrise != 0 {
+		pointFcast.Sunrise = time.Unix(fc.Sunrise, 0).In(loc).Format(dateLayout)
+	}
+	if fc.Sunset != 0 {
+		pointFcast.Sunset = time.Unix(fc.Sunset, 0).In(loc).Format(dateLayout)
+	}
+
+	for _, item := range fc.List {
+		pointFcast.Forecasts = append(pointFcast.Forecasts, units.Forecast(item))
+	}
+
+	return pointFcast
+}
+
+// ошибки внешнего источника: источник недоступен или отключен предохранителем
+func providerStatusCode(err error) int {
+	var statusErr *middleware.StatusError
+
+	switch {
+	case errors.Is(err, middleware.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		// источник не ответил вовремя, в том числе из-за очереди в общем ограничителе
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
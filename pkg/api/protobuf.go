@@ -0,0 +1,94 @@
+package api
+
+import (
+	"io"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufRenderer кодирует записи прогноза сообщением ForecastSlots из forecast.proto,
+// поля с нулевым значением не пишутся, как в proto3
+type protobufRenderer struct{}
+
+func (protobufRenderer) ContentType() string { return "application/x-protobuf" }
+
+func (protobufRenderer) Supports(v interface{}) bool { return supportsSlots(v) }
+
+func (protobufRenderer) Render(w io.Writer, v interface{}) error {
+	slots, _ := forecastSlots(v)
+
+	var b, slot []byte
+	for _, s := range slots {
+		slot = appendForecastSlot(slot[:0], s)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, slot)
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+func appendForecastSlot(b []byte, s ForecastSlot) []byte {
+	_, offset := s.Time.Zone()
+
+	b = appendInt(b, 1, int64(s.CityID))
+	b = appendInt(b, 2, s.Time.Unix())
+	b = appendInt(b, 3, int64(offset))
+	if s.IssuedAt != nil {
+		b = appendInt(b, 4, s.IssuedAt.Unix())
+	}
+	if s.Interpolated {
+		b = appendInt(b, 5, 1)
+	}
+	b = appendString(b, 6, string(s.Units))
+	b = appendDouble(b, 7, s.Temp)
+	b = appendDouble(b, 8, s.FeelsLike)
+	b = appendDouble(b, 9, s.TempMin)
+	b = appendDouble(b, 10, s.TempMax)
+	b = appendInt(b, 11, int64(s.Pressure))
+	b = appendInt(b, 12, int64(s.SeaLevel))
+	b = appendInt(b, 13, int64(s.GrndLevel))
+	b = appendInt(b, 14, int64(s.Humidity))
+	b = appendDouble(b, 15, s.TempKf)
+	b = appendInt(b, 16, int64(s.WeatherID))
+	b = appendString(b, 17, s.WeatherMain)
+	b = appendString(b, 18, s.WeatherDescription)
+	b = appendString(b, 19, s.WeatherIcon)
+	b = appendInt(b, 20, int64(s.Clouds))
+	b = appendDouble(b, 21, s.WindSpeed)
+	b = appendInt(b, 22, int64(s.WindDeg))
+	b = appendDouble(b, 23, s.WindGust)
+	b = appendInt(b, 24, int64(s.Visibility))
+	b = appendDouble(b, 25, s.Pop)
+	b = appendDouble(b, 26, s.Rain3h)
+	b = appendString(b, 27, s.Pod)
+	b = appendString(b, 28, s.DtTxt)
+
+	return b
+}
+
+// int32, int64 и bool в proto3 кодируются одинаково, отрицательные int32 занимают 10 байт
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// поле сообщения из forecast.proto
+type protoField struct {
+	name string
+	kind string
+}
+
+var protoFieldRe = regexp.MustCompile(`^\s*(int32|int64|bool|double|string)\s+(\w+)\s*=\s*(\d+);`)
+
+// protoSchema поля сообщения ForecastSlot по номерам, читается из forecast.proto,
+// что бы тест сверял кодирование с описанием, которое получают клиенты
+func protoSchema(t *testing.T) map[protowire.Number]protoField {
+	t.Helper()
+
+	data, err := os.ReadFile("forecast.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := regexp.MustCompile(`(?s)message ForecastSlot \{(.*?)\n\}`).FindSubmatch(data)
+	if message == nil {
+		t.Fatal("forecast.proto: message ForecastSlot not found")
+	}
+
+	fields := make(map[protowire.Number]protoField)
+	for _, line := range bytes.Split(message[1], []byte("\n")) {
+		m := protoFieldRe.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		num, _ := strconv.Atoi(string(m[3]))
+		fields[protowire.Number(num)] = protoField{name: string(m[2]), kind: string(m[1])}
+	}
+	if len(fields) == 0 {
+		t.Fatal("forecast.proto: ForecastSlot has no fields")
+	}
+
+	return fields
+}
+
+// TestProtobufRoundTrip кодирует запись прогноза, в которой заполнены все поля, разбирает ответ
+// по номерам и типам полей из forecast.proto и сравнивает значения с тем же ответом в JSON
+func TestProtobufRoundTrip(t *testing.T) {
+	schema := protoSchema(t)
+
+	loc := time.FixedZone("", 3*60*60)
+	issuedAt := time.Date(2024, 3, 30, 9, 5, 0, 0, time.UTC)
+	slot := ForecastSlot{
+		CityID:             7,
+		Time:               time.Date(2024, 3, 30, 12, 0, 0, 0, loc),
+		IssuedAt:           &issuedAt,
+		Interpolated:       true,
+		Units:              UnitsMetric,
+		Temp:               -3.5,
+		FeelsLike:          -7.25,
+		TempMin:            -4.1,
+		TempMax:            -2.9,
+		Pressure:           1012,
+		SeaLevel:           1015,
+		GrndLevel:          990,
+		Humidity:           81,
+		TempKf:             -0.4,
+		WeatherID:          600,
+		WeatherMain:        "Snow",
+		WeatherDescription: "небольшой снег",
+		WeatherIcon:        "13d",
+		Clouds:             100,
+		WindSpeed:          4.2,
+		WindDeg:            -15,
+		WindGust:           9.8,
+		Visibility:         8000,
+		Pop:                0.64,
+		Rain3h:             0.31,
+		Pod:                "d",
+		DtTxt:              "2024-03-30 09:00:00",
+	}
+
+	var buf bytes.Buffer
+	err := protobufRenderer{}.Render(&buf, ForecastSlotsV1{Slots: []ForecastSlot{slot, slot}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := decodeForecastSlots(t, buf.Bytes(), schema)
+	if len(decoded) != 2 {
+		t.Fatalf("got %d slots, want 2", len(decoded))
+	}
+
+	want := expectedProtoValues(t, slot)
+	for num, field := range schema {
+		if _, ok := want[field.name]; !ok {
+			t.Errorf("field %s = %d in forecast.proto has no ForecastSlot counterpart", field.name, num)
+		}
+	}
+	for name, value := range want {
+		for i, got := range decoded {
+			if got[name] != value {
+				t.Errorf("slot %d: field %s = %v, want %v", i, name, got[name], value)
+			}
+		}
+	}
+}
+
+// значения полей ForecastSlot по именам полей forecast.proto, имена совпадают с JSON,
+// кроме времени, которое в Protobuf передаётся unix-временем и сдвигом от UTC
+func expectedProtoValues(t *testing.T, slot ForecastSlot) map[string]interface{} {
+	t.Helper()
+
+	data, err := json.Marshal(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values map[string]interface{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, offset := slot.Time.Zone()
+	values["time"] = float64(slot.Time.Unix())
+	values["utc_offset"] = float64(offset)
+	values["issued_at"] = float64(slot.IssuedAt.Unix())
+
+	return values
+}
+
+// decodeForecastSlots разбирает сообщение ForecastSlots, значения полей приводятся к типам,
+// которые даёт json.Unmarshal, что бы их можно было сравнить с ответом в JSON
+func decodeForecastSlots(t *testing.T, b []byte, schema map[protowire.Number]protoField) []map[string]interface{} {
+	t.Helper()
+
+	var slots []map[string]interface{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || num != 1 || typ != protowire.BytesType {
+			t.Fatalf("ForecastSlots: unexpected field %d of type %d", num, typ)
+		}
+		b = b[n:]
+
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		slots = append(slots, decodeForecastSlot(t, message, schema))
+	}
+
+	return slots
+}
+
+func decodeForecastSlot(t *testing.T, b []byte, schema map[protowire.Number]protoField) map[string]interface{} {
+	t.Helper()
+
+	values := make(map[string]interface{})
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		field, ok := schema[num]
+		if !ok {
+			t.Fatalf("ForecastSlot: field %d is not in forecast.proto", num)
+		}
+
+		switch field.kind {
+		case "int32", "int64", "bool":
+			if typ != protowire.VarintType {
+				t.Fatalf("field %s: wire type %d, want varint", field.name, typ)
+			}
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			switch field.kind {
+			case "int32":
+				values[field.name] = float64(int32(v))
+			case "int64":
+				values[field.name] = float64(int64(v))
+			default:
+				values[field.name] = v != 0
+			}
+		case "double":
+			if typ != protowire.Fixed64Type {
+				t.Fatalf("field %s: wire type %d, want fixed64", field.name, typ)
+			}
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			values[field.name] = math.Float64frombits(v)
+		case "string":
+			if typ != protowire.BytesType {
+				t.Fatalf("field %s: wire type %d, want bytes", field.name, typ)
+			}
+			var v string
+			v, n = protowire.ConsumeString(b)
+			values[field.name] = v
+		}
+		if n < 0 {
+			t.Fatalf("field %s: %s", field.name, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+
+	return values
+}
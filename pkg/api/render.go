@@ -2,11 +2,14 @@ package api
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
 )
 
 // JSON sends json response
@@ -19,11 +22,16 @@ func responseJSON(w http.ResponseWriter, r *http.Request, status int, v interfac
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writeResponse(w, status, "application/json; charset=utf-8", buf.Bytes())
+}
+
+// writeResponse отправляет готовое тело ответа, ответ в любом формате пишется только через неё
+func writeResponse(w http.ResponseWriter, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
 
 	w.WriteHeader(status)
 
-	_, err := w.Write(buf.Bytes())
+	_, err := w.Write(body)
 	if err != nil {
 		log.Println(err)
 	}
@@ -49,16 +57,23 @@ var (
 
 // StatusCode gets http code from error
 func StatusCode(err error) int {
-	if errors.Is(err, ErrNotFound) {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, openweather.ErrCityNotFound) || errors.Is(err, sql.ErrNoRows) {
 		return http.StatusNotFound
 	}
 
+	if errors.Is(err, openweather.ErrCityExists) {
+		return http.StatusConflict
+	}
+
 	return http.StatusInternalServerError
 }
 
-func CheckHttpMethod(w http.ResponseWriter, r *http.Request) {
+// CheckHttpMethod отвечает 405 на все методы кроме GET, false значит ответ уже отправлен
+func CheckHttpMethod(w http.ResponseWriter, r *http.Request) bool {
 	if r.Method != http.MethodGet {
-		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("bad method: %s", r.Method), "method should be get")
-		return
+		ErrorJSON(w, r, http.StatusMethodNotAllowed, fmt.Errorf("bad method: %s", r.Method), "method should be get")
+		return false
 	}
+
+	return true
 }
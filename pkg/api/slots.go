@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// ForecastSlot запись прогноза на 3 часа с развёрнутыми полями ListData,
+// в таком виде прогноз отдаётся в CSV, NDJSON и Protobuf
+type ForecastSlot struct {
+	CityID int32 `json:"city_id"`
+	// время по местному времени города
+	Time time.Time `json:"time"`
+	// время загрузки прогноза, только в истории прогноза
+	IssuedAt           *time.Time `json:"issued_at,omitempty"`
+	Interpolated       bool       `json:"interpolated"`
+	Units              Units      `json:"units"`
+	Temp               float64    `json:"temp"`
+	FeelsLike          float64    `json:"feels_like"`
+	TempMin            float64    `json:"temp_min"`
+	TempMax            float64    `json:"temp_max"`
+	Pressure           int        `json:"pressure"`
+	SeaLevel           int        `json:"sea_level"`
+	GrndLevel          int        `json:"grnd_level"`
+	Humidity           int        `json:"humidity"`
+	TempKf             float64    `json:"temp_kf"`
+	WeatherID          int        `json:"weather_id"`
+	WeatherMain        string     `json:"weather_main"`
+	WeatherDescription string     `json:"weather_description"`
+	WeatherIcon        string     `json:"weather_icon"`
+	Clouds             int        `json:"clouds"`
+	WindSpeed          float64    `json:"wind_speed"`
+	WindDeg            int        `json:"wind_deg"`
+	WindGust           float64    `json:"wind_gust"`
+	Visibility         int        `json:"visibility"`
+	Pop                float64    `json:"pop"`
+	Rain3h             float64    `json:"rain_3h"`
+	Pod                string     `json:"pod"`
+	DtTxt              string     `json:"dt_txt"`
+}
+
+// ForecastSlotsV1 прогноз по городу за период с шагом 3 часа
+type ForecastSlotsV1 struct {
+	CityID int32          `json:"city_id"`
+	Units  Units          `json:"units"`
+	Slots  []ForecastSlot `json:"slots"`
+}
+
+// slotter ответы, которые можно отдать построчно записями прогноза на 3 часа,
+// false если в ответе нет записей прогноза
+type slotter interface {
+	forecastSlots() ([]ForecastSlot, bool)
+}
+
+// newForecastSlot fc уже переведён в систему единиц units,
+// основной считается первая погода из списка, как в DailyFcastForCity
+func newForecastSlot(cityID int32, t time.Time, units Units, fc openweather.Forecast) ForecastSlot {
+	data := fc.ForecastData
+
+	slot := ForecastSlot{
+		CityID:     cityID,
+		Time:       t,
+		Units:      units,
+		Temp:       fc.Temp,
+		FeelsLike:  data.Main.FeelsLike,
+		TempMin:    data.Main.TempMin,
+		TempMax:    data.Main.TempMax,
+		Pressure:   data.Main.Pressure,
+		SeaLevel:   data.Main.SeaLevel,
+		GrndLevel:  data.Main.GrndLevel,
+		Humidity:   data.Main.Humidity,
+		TempKf:     data.Main.TempKf,
+		Clouds:     data.Clouds.All,
+		WindSpeed:  data.Wind.Speed,
+		WindDeg:    data.Wind.Deg,
+		WindGust:   data.Wind.Gust,
+		Visibility: data.Visibility,
+		Pop:        data.Pop,
+		Rain3h:     data.Rain.ThreeH,
+		Pod:        data.Sys.Pod,
+		DtTxt:      data.DtTxt,
+	}
+	if len(data.Weather) > 0 {
+		slot.WeatherID = data.Weather[0].ID
+		slot.WeatherMain = data.Weather[0].Main
+		slot.WeatherDescription = data.Weather[0].Description
+		slot.WeatherIcon = data.Weather[0].Icon
+	}
+
+	return slot
+}
+
+func (fc FcastOnTime) forecastSlots() ([]ForecastSlot, bool) {
+	slot := newForecastSlot(fc.cityID, fc.Date, fc.Units, fc.Forecast)
+	slot.Interpolated = fc.Interpolated
+
+	return []ForecastSlot{slot}, true
+}
+
+func (at ForecastAtV1) forecastSlots() ([]ForecastSlot, bool) {
+	return at.fc.forecastSlots()
+}
+
+func (h ForecastHistory) forecastSlots() ([]ForecastSlot, bool) {
+	slots := make([]ForecastSlot, 0, len(h.Revisions))
+	for _, revision := range h.Revisions {
+		slot := newForecastSlot(h.CityID, h.Date, h.Units, revision.Forecast)
+		issuedAt := revision.IssuedAt
+		slot.IssuedAt = &issuedAt
+		slots = append(slots, slot)
+	}
+
+	return slots, true
+}
+
+func (p PointFcast) forecastSlots() ([]ForecastSlot, bool) {
+	loc := time.FixedZone("", p.Timezone)
+
+	slots := make([]ForecastSlot, 0, len(p.Forecasts))
+	for _, fc := range p.Forecasts {
+		slots = append(slots, newForecastSlot(0, time.Unix(fc.Date, 0).In(loc), p.Units, fc))
+	}
+
+	return slots, true
+}
+
+// краткий прогноз не делится на записи по 3 часа, города с ошибкой пропускаются
+func (b BatchForecast) forecastSlots() ([]ForecastSlot, bool) {
+	if b.Type != batchFull {
+		return nil, false
+	}
+
+	slots := make([]ForecastSlot, 0, len(b.Forecasts))
+	for _, item := range b.Forecasts {
+		if item.Full == nil {
+			continue
+		}
+		full := *item.Full
+		full.cityID = item.CityID
+		slot, _ := full.forecastSlots()
+		slots = append(slots, slot...)
+	}
+
+	return slots, true
+}
+
+func (s ForecastSlotsV1) forecastSlots() ([]ForecastSlot, bool) {
+	return s.Slots, true
+}
+
+func parseForecastSlots(cityID int32, loc *time.Location, rows []repository.ForecastRangeRow, units Units) (ForecastSlotsV1, error) {
+	slots := ForecastSlotsV1{
+		CityID: cityID,
+		Units:  units,
+		Slots:  make([]ForecastSlot, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		var fc openweather.Forecast
+		err := json.Unmarshal(row.Weather, &fc)
+		if err != nil {
+			return slots, err
+		}
+
+		slots.Slots = append(slots.Slots, newForecastSlot(cityID, time.Unix(row.Date, 0).In(loc), units, units.Forecast(fc)))
+	}
+
+	return slots, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// формат даты в запросах и ответах API, время местное для города
+const dateLayout = "2006-01-02 15:04:05"
+
+// cityLocation часовой пояс города по сдвигу от UTC из ответа openweather,
+// пока прогноз по городу не загружен сдвиг нулевой
+func cityLocation(city repository.CityRow) *time.Location {
+	offset := int(city.Timezone)
+
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	name := fmt.Sprintf("UTC%c%02d:%02d", sign, offset/3600, offset%3600/60)
+
+	return time.FixedZone(name, int(city.Timezone))
+}
+
+// parseRequestTime разбирает время из запроса: в формате RFC 3339 сдвиг берётся из самой строки,
+// в формате "2006-01-02 15:04:05" время считается местным для города
+func parseRequestTime(value string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(dateLayout, value, loc)
+}
+
+// данные о городе берутся из кэша краткого прогноза, при промахе из БД
+func (a *API) city(ctx context.Context, cityID int32) (repository.CityRow, error) {
+	if fc, ok := a.cache.Short(cityID); ok {
+		return fc.City, nil
+	}
+
+	return a.repo.City(ctx, cityID)
+}
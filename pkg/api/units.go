@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+)
+
+// Units система единиц в ответе, названия как в openweather:
+// standard - кельвины и м/с (так данные хранятся в БД), metric - цельсии и м/с, imperial - фаренгейты и мили в час
+type Units string
+
+const (
+	UnitsStandard Units = "standard"
+	UnitsMetric   Units = "metric"
+	UnitsImperial Units = "imperial"
+)
+
+const (
+	absoluteZero = 273.15
+	msToMph      = 2.2369362920544
+)
+
+// ParseUnits проверяет значение units, пустое значение заменяется на def
+func ParseUnits(value string, def Units) (Units, error) {
+	switch Units(value) {
+	case "":
+		return def, nil
+	case UnitsStandard, UnitsMetric, UnitsImperial:
+		return Units(value), nil
+	default:
+		return "", fmt.Errorf("unknown units: %s", value)
+	}
+}
+
+// система единиц из параметра units, если он не указан то значение по умолчанию сервера
+func (a *API) units(w http.ResponseWriter, r *http.Request) (Units, bool) {
+	units, err := ParseUnits(r.FormValue("units"), a.cfg.DefaultUnits)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "units should be metric, imperial or standard")
+		return "", false
+	}
+
+	return units, true
+}
+
+// Temp переводит температуру из кельвинов
+func (u Units) Temp(kelvin float64) float64 {
+	switch u {
+	case UnitsMetric:
+		return round(kelvin - absoluteZero)
+	case UnitsImperial:
+		return round((kelvin-absoluteZero)*9/5 + 32)
+	default:
+		return round(kelvin)
+	}
+}
+
+// Speed переводит скорость из м/с
+func (u Units) Speed(ms float64) float64 {
+	if u == UnitsImperial {
+		return round(ms * msToMph)
+	}
+
+	return round(ms)
+}
+
+// FromTemp переводит температуру обратно в кельвины, например порог из запроса
+func (u Units) FromTemp(v float64) float64 {
+	switch u {
+	case UnitsMetric:
+		return round(v + absoluteZero)
+	case UnitsImperial:
+		return round((v-32)*5/9 + absoluteZero)
+	default:
+		return v
+	}
+}
+
+// FromSpeed переводит скорость обратно в м/с
+func (u Units) FromSpeed(v float64) float64 {
+	if u == UnitsImperial {
+		return round(v / msToMph)
+	}
+
+	return v
+}
+
+// Forecast переводит все температуры и скорости ветра в записи прогноза,
+// давление в гПа, осадки в мм и видимость в метрах openweather отдаёт одинаково во всех системах
+func (u Units) Forecast(fc openweather.Forecast) openweather.Forecast {
+	fc.Temp = u.Temp(fc.Temp)
+	fc.ForecastData = u.ListData(fc.ForecastData)
+
+	return fc
+}
+
+func (u Units) ListData(item openweather.ListData) openweather.ListData {
+	item.Main.Temp = u.Temp(item.Main.Temp)
+	item.Main.FeelsLike = u.Temp(item.Main.FeelsLike)
+	item.Main.TempMin = u.Temp(item.Main.TempMin)
+	item.Main.TempMax = u.Temp(item.Main.TempMax)
+	// temp_kf разница температур, а не температура, сдвиг шкалы к ней не применяется
+	if u == UnitsImperial {
+		item.Main.TempKf = round(item.Main.TempKf * 9 / 5)
+	}
+	item.Wind.Speed = u.Speed(item.Wind.Speed)
+	item.Wind.Gust = u.Speed(item.Wind.Gust)
+	// слайс погодных условий общий с исходной записью, копируем, что бы не менять кэш
+	item.Weather = append(item.Weather[:0:0], item.Weather...)
+
+	return item
+}
+
+// округляем до сотых, как в ответах openweather
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
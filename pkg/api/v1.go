@@ -0,0 +1,384 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// CityV1 город в /v1, все поля в snake_case без обёрток sql.NullString
+type CityV1 struct {
+	ID       int32   `json:"id"`
+	Name     string  `json:"name"`
+	Country  string  `json:"country"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Disabled bool    `json:"disabled"`
+	// сдвиг местного времени города от UTC в секундах
+	Timezone int32 `json:"timezone"`
+}
+
+// ShortForecastV1 краткий прогноз: средняя температура и дни по местному времени города, на которые есть прогноз
+type ShortForecastV1 struct {
+	City    CityV1     `json:"city"`
+	Units   Units      `json:"units"`
+	AvgTemp float64    `json:"avg_temp"`
+	Sunrise *time.Time `json:"sunrise,omitempty"`
+	Sunset  *time.Time `json:"sunset,omitempty"`
+	Dates   []string   `json:"dates"`
+}
+
+// ForecastAtV1 прогноз на время, время в ответе с местным сдвигом города
+type ForecastAtV1 struct {
+	CityID int32     `json:"city_id"`
+	Time   time.Time `json:"time"`
+	// true если прогноз интерполирован между двумя записями
+	Interpolated bool          `json:"interpolated"`
+	Units        Units         `json:"units"`
+	Temperature  float64       `json:"temperature"`
+	FeelsLike    float64       `json:"feels_like"`
+	TempMin      float64       `json:"temp_min"`
+	TempMax      float64       `json:"temp_max"`
+	Pressure     int           `json:"pressure"`
+	Humidity     int           `json:"humidity"`
+	Clouds       int           `json:"clouds"`
+	Visibility   int           `json:"visibility"`
+	Pop          float64       `json:"pop"`
+	Rain3h       float64       `json:"rain_3h"`
+	Wind         WindV1        `json:"wind"`
+	Conditions   []ConditionV1 `json:"conditions"`
+
+	fc FcastOnTime
+}
+
+type WindV1 struct {
+	Speed float64 `json:"speed"`
+	Deg   int     `json:"deg"`
+	Gust  float64 `json:"gust"`
+}
+
+type ConditionV1 struct {
+	ID          int    `json:"id"`
+	Condition   string `json:"condition"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// V1Cities обрабатывает GET /v1/cities
+func (a *API) V1Cities(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	rows, err := a.repo.CitiesList(r.Context())
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get cities list")
+		return
+	}
+
+	if notModified(w, r, citiesVersion(r, rows)) {
+		return
+	}
+
+	cities := make([]CityV1, 0, len(rows))
+	for _, row := range rows {
+		cities = append(cities, CityV1{
+			ID:       row.ID,
+			Name:     row.City.String,
+			Country:  row.Country.String,
+			Lat:      row.Latitude,
+			Lon:      row.Longitude,
+			Disabled: row.Disabled,
+			Timezone: row.Timezone,
+		})
+	}
+
+	responseJSON(w, r, http.StatusOK, cities)
+}
+
+// V1City обрабатывает GET /v1/cities/{id}, /v1/cities/{id}/forecast, /v1/cities/{id}/forecast/at?date=
+// и /v1/cities/{id}/forecast/slots?from=&to=
+func (a *API) V1City(w http.ResponseWriter, r *http.Request) {
+	if !CheckHttpMethod(w, r) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/cities/"), "/")
+
+	id, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "wrong city id")
+		return
+	}
+	cityID := int32(id)
+
+	switch strings.Join(parts[1:], "/") {
+	case "":
+		a.v1City(w, r, cityID)
+	case "forecast":
+		a.v1ShortForecast(w, r, cityID)
+	case "forecast/at":
+		a.v1ForecastAt(w, r, cityID)
+	case "forecast/slots":
+		a.v1ForecastSlots(w, r, cityID)
+	default:
+		ErrorJSON(w, r, http.StatusNotFound, ErrNotFound, "unknown city resource")
+	}
+}
+
+func (a *API) v1City(w http.ResponseWriter, r *http.Request, cityID int32) {
+	city, err := a.city(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, cityID, city)) {
+		return
+	}
+
+	responseJSON(w, r, http.StatusOK, cityV1(cityID, city))
+}
+
+func (a *API) v1ShortForecast(w http.ResponseWriter, r *http.Request, cityID int32) {
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	fc, err := a.shortFcast(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+	if len(fc.Forecast) == 0 {
+		ErrorJSON(w, r, http.StatusNotFound, errNoForecast, "forecast is not loaded yet")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, cityID, fc.City)) {
+		return
+	}
+
+	Render(w, r, http.StatusOK, parseShortForecastV1(cityID, fc.City, fc.Forecast, units))
+}
+
+func parseShortForecastV1(cityID int32, city repository.CityRow, rows []repository.ShortFcastForCityRow, units Units) ShortForecastV1 {
+	loc := cityLocation(city)
+
+	short := ShortForecastV1{
+		City:  cityV1(cityID, city),
+		Units: units,
+		Dates: make([]string, 0, 6),
+	}
+	if city.Sunrise != 0 {
+		sunrise := time.Unix(city.Sunrise, 0).In(loc)
+		short.Sunrise = &sunrise
+	}
+	if city.Sunset != 0 {
+		sunset := time.Unix(city.Sunset, 0).In(loc)
+		short.Sunset = &sunset
+	}
+
+	var sum float64
+	for _, row := range rows {
+		day := time.Unix(row.Date, 0).In(loc).Format(time.DateOnly)
+		if len(short.Dates) == 0 || short.Dates[len(short.Dates)-1] != day {
+			short.Dates = append(short.Dates, day)
+		}
+		sum += row.Temperature
+	}
+	short.AvgTemp = units.Temp(sum / float64(len(rows)))
+
+	return short
+}
+
+func (a *API) v1ForecastAt(w http.ResponseWriter, r *http.Request, cityID int32) {
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	city, err := a.city(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+	loc := cityLocation(city)
+
+	t, err := parseRequestTime(r.FormValue("date"), loc)
+	if err != nil {
+		ErrorJSON(w, r, http.StatusBadRequest, err, "date should be in format 2006-01-02 15:04:05 or RFC 3339")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, cityID, city)) {
+		return
+	}
+
+	rows, err := a.fullFcastByTime(r.Context(), repository.FullFcastByTimeParams{
+		CityID: cityID,
+		Date:   t.Unix(),
+	})
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get full forecast")
+		return
+	}
+	if len(rows) == 0 {
+		ErrorJSON(w, r, http.StatusNotFound, errNoForecast, "forecast is not loaded yet")
+		return
+	}
+
+	fc, err := parseFcastOnTime(cityID, t.Unix(), loc, rows, units)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't encode forecast")
+		return
+	}
+
+	Render(w, r, http.StatusOK, forecastAtV1(cityID, fc))
+}
+
+// записи прогноза за период без интерполяции, границы from и to включаются,
+// без from и to отдаётся весь загруженный прогноз
+func (a *API) v1ForecastSlots(w http.ResponseWriter, r *http.Request, cityID int32) {
+	units, ok := a.units(w, r)
+	if !ok {
+		return
+	}
+
+	city, err := a.city(r.Context(), cityID)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get city data")
+		return
+	}
+	loc := cityLocation(city)
+
+	params := repository.ForecastRangeParams{
+		CityID:   cityID,
+		DateFrom: 0,
+		DateTo:   math.MaxInt64,
+	}
+	if value := r.FormValue("from"); value != "" {
+		from, err := parseRequestTime(value, loc)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "from should be in format 2006-01-02 15:04:05 or RFC 3339")
+			return
+		}
+		params.DateFrom = from.Unix()
+	}
+	if value := r.FormValue("to"); value != "" {
+		to, err := parseRequestTime(value, loc)
+		if err != nil {
+			ErrorJSON(w, r, http.StatusBadRequest, err, "to should be in format 2006-01-02 15:04:05 or RFC 3339")
+			return
+		}
+		params.DateTo = to.Unix()
+	}
+	if params.DateFrom > params.DateTo {
+		ErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("from is after to"), "from should be before to")
+		return
+	}
+
+	if notModified(w, r, a.cityVersion(r, cityID, city)) {
+		return
+	}
+
+	rows, err := a.repo.ForecastRange(r.Context(), params)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't get forecast")
+		return
+	}
+
+	slots, err := parseForecastSlots(cityID, loc, rows, units)
+	if err != nil {
+		ErrorJSON(w, r, StatusCode(err), err, "can't encode forecast")
+		return
+	}
+
+	Render(w, r, http.StatusOK, slots)
+}
+
+func forecastAtV1(cityID int32, fc FcastOnTime) ForecastAtV1 {
+	data := fc.Forecast.ForecastData
+
+	at := ForecastAtV1{
+		CityID:       cityID,
+		Time:         fc.Date,
+		Interpolated: fc.Interpolated,
+		Units:        fc.Units,
+		Temperature:  fc.Temperature,
+		FeelsLike:    data.Main.FeelsLike,
+		TempMin:      data.Main.TempMin,
+		TempMax:      data.Main.TempMax,
+		Pressure:     data.Main.Pressure,
+		Humidity:     data.Main.Humidity,
+		Clouds:       data.Clouds.All,
+		Visibility:   data.Visibility,
+		Pop:          data.Pop,
+		Rain3h:       data.Rain.ThreeH,
+		Wind: WindV1{
+			Speed: data.Wind.Speed,
+			Deg:   data.Wind.Deg,
+			Gust:  data.Wind.Gust,
+		},
+		Conditions: make([]ConditionV1, 0, len(data.Weather)),
+		fc:         fc,
+	}
+	for _, weather := range data.Weather {
+		at.Conditions = append(at.Conditions, ConditionV1{
+			ID:          weather.ID,
+			Condition:   weather.Main,
+			Description: weather.Description,
+			Icon:        weather.Icon,
+		})
+	}
+
+	return at
+}
+
+func cityV1(cityID int32, city repository.CityRow) CityV1 {
+	return CityV1{
+		ID:       cityID,
+		Name:     city.City.String,
+		Country:  city.Country.String,
+		Lat:      city.Latitude,
+		Lon:      city.Longitude,
+		Disabled: city.Disabled,
+		Timezone: city.Timezone,
+	}
+}
+
+// deprecated помечает устаревший маршрут заголовками Deprecation и Link на замену из /v1
+func deprecated(successor func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor(r)))
+
+		next(w, r)
+	}
+}
+
+// адрес в /v1 для города из параметра city_id устаревшего маршрута
+func v1CityPath(suffix string, params ...string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		path := "/v1/cities/" + url.PathEscape(r.FormValue("city_id")) + suffix
+
+		query := url.Values{}
+		for _, param := range params {
+			if value := r.FormValue(param); value != "" {
+				query.Set(param, value)
+			}
+		}
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+
+		return path
+	}
+}
@@ -0,0 +1,116 @@
+// Package cache содержит простой кэш в памяти со временем жизни записей и счётчиками попаданий
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+)
+
+// при достижении этого размера из кэша удаляются устаревшие записи
+const defaultMaxEntries = 10000
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+type Cache[K comparable, V any] struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	items map[K]entry[V]
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:        ttl,
+		maxEntries: defaultMaxEntries,
+		items:      make(map[K]entry[V]),
+	}
+}
+
+// Get возвращает значение, если оно есть в кэше и не устарело
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	item, ok := c.items[key]
+	if ok && time.Now().After(item.expiresAt) {
+		delete(c.items, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	c.hits.Add(1)
+	return item.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.items) >= c.maxEntries {
+		c.evict(now)
+	}
+
+	c.items[key] = entry[V]{
+		value:     value,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// DeleteFunc удаляет все записи, для ключей которых del возвращает true
+func (c *Cache[K, V]) DeleteFunc(del func(key K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.items {
+		if del(key) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// RegisterMetrics отдаёт счётчики попаданий и промахов и размер кэша в /metrics с меткой cache=name
+func (c *Cache[K, V]) RegisterMetrics(name string) {
+	metrics.RegisterCache(name, c.stats)
+}
+
+func (c *Cache[K, V]) stats() (hits, misses uint64, entries int) {
+	c.mu.Lock()
+	entries = len(c.items)
+	c.mu.Unlock()
+
+	return c.hits.Load(), c.misses.Load(), entries
+}
+
+// удаляем устаревшие записи, если их нет, то произвольную, что бы кэш не рос бесконечно
+func (c *Cache[K, V]) evict(now time.Time) {
+	for key, item := range c.items {
+		if now.After(item.expiresAt) {
+			delete(c.items, key)
+		}
+	}
+
+	if len(c.items) < c.maxEntries {
+		return
+	}
+
+	for key := range c.items {
+		delete(c.items, key)
+		return
+	}
+}
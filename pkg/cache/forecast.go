@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+)
+
+// ShortForecast данные из БД для краткого прогноза по городу
+type ShortForecast struct {
+	City     repository.CityRow
+	Forecast []repository.ShortFcastForCityRow
+}
+
+// шаг записей прогноза в секундах, записи начинаются в 00, 03, ... 21 часов UTC
+const slotSeconds = 3 * 60 * 60
+
+// FullKey ключ полного прогноза: город и начало 3-часового интервала, в который попало запрошенное время
+type FullKey struct {
+	CityID int32
+	Date   int64
+}
+
+// NewFullKey для любого времени внутри интервала между записями из БД приходят одни и те же две записи,
+// поэтому все запросы внутри интервала попадают в один ключ
+func NewFullKey(cityID int32, date int64) FullKey {
+	slot := date - date%slotSeconds
+	if date%slotSeconds < 0 {
+		slot -= slotSeconds
+	}
+
+	return FullKey{CityID: cityID, Date: slot}
+}
+
+// ForecastCache кэш прогнозов из БД, данные в БД меняются только при загрузке прогнозов,
+// по этому кэш сбрасывается по городу после каждой записи прогноза в БД.
+//
+// Сброс может произойти, пока обработчик читает данные из БД, тогда прочитанные данные уже устарели.
+// Что бы они не попали в кэш, у каждого города есть поколение, которое растёт при каждом сбросе:
+// обработчик берёт поколение до чтения из БД, а запись в кэш с другим поколением отбрасывается
+type ForecastCache struct {
+	short *Cache[int32, ShortForecast]
+	full  *Cache[FullKey, []repository.FullFcastByTimeRow]
+
+	// mu упорядочивает запись в кэш и сброс, generations поколения городов
+	mu          sync.Mutex
+	generations map[int32]uint64
+}
+
+func NewForecastCache(ttl time.Duration) *ForecastCache {
+	return &ForecastCache{
+		short:       New[int32, ShortForecast](ttl),
+		full:        New[FullKey, []repository.FullFcastByTimeRow](ttl),
+		generations: make(map[int32]uint64),
+	}
+}
+
+// Generation поколение города, берётся до чтения из БД и передаётся в SetShort и SetFull
+func (c *ForecastCache) Generation(cityID int32) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[cityID]
+}
+
+func (c *ForecastCache) Short(cityID int32) (ShortForecast, bool) {
+	return c.short.Get(cityID)
+}
+
+// SetShort сохраняет краткий прогноз, если с момента получения generation город не сбрасывался
+func (c *ForecastCache) SetShort(cityID int32, generation uint64, fc ShortForecast) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[cityID] == generation {
+		c.short.Set(cityID, fc)
+	}
+}
+
+func (c *ForecastCache) Full(key FullKey) ([]repository.FullFcastByTimeRow, bool) {
+	return c.full.Get(key)
+}
+
+// SetFull сохраняет полный прогноз, если с момента получения generation город не сбрасывался
+func (c *ForecastCache) SetFull(key FullKey, generation uint64, fc []repository.FullFcastByTimeRow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[key.CityID] == generation {
+		c.full.Set(key, fc)
+	}
+}
+
+// CityUpdated сбрасывает все записи по городу, вызывается после записи прогноза в БД
+// и после изменения или удаления города
+func (c *ForecastCache) CityUpdated(ctx context.Context, cityID int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[cityID]++
+	c.short.DeleteFunc(func(key int32) bool {
+		return key == cityID
+	})
+	c.full.DeleteFunc(func(key FullKey) bool {
+		return key.CityID == cityID
+	})
+}
+
+// RegisterMetrics отдаёт счётчики кэша краткого и полного прогноза в /metrics
+func (c *ForecastCache) RegisterMetrics() {
+	c.short.RegisterMetrics("short")
+	c.full.RegisterMetrics("full")
+}
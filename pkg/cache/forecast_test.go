@@ -0,0 +1,22 @@
+package cache
+
+import "testing"
+
+func TestNewFullKey(t *testing.T) {
+	tests := []struct {
+		date int64
+		want int64
+	}{
+		{1711800000, 1711800000}, // 2024-03-30 12:00:00 UTC, начало интервала
+		{1711800001, 1711800000},
+		{1711810799, 1711800000}, // 14:59:59
+		{1711810800, 1711810800}, // 15:00:00, следующий интервал
+		{-1, -10800},
+	}
+
+	for _, tt := range tests {
+		if got := NewFullKey(1, tt.date); got != (FullKey{CityID: 1, Date: tt.want}) {
+			t.Errorf("NewFullKey(1, %d) = %+v, want date %d", tt.date, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
+	"golang.org/x/sync/singleflight"
+)
+
+// координаты округляются до 2 знаков, это около километра, прогноз внутри такого квадрата не отличается
+const pointPrecision = 100
+
+// PointKey координаты, умноженные на pointPrecision и округлённые
+type PointKey struct {
+	Lat int32
+	Lon int32
+}
+
+// NewPointKey округляет координаты до ключа кэша
+func NewPointKey(latitude, longitude float64) PointKey {
+	return PointKey{
+		Lat: int32(math.Round(latitude * pointPrecision)),
+		Lon: int32(math.Round(longitude * pointPrecision)),
+	}
+}
+
+// Coords координаты, по которым запрашивается прогноз для ключа
+func (k PointKey) Coords() (latitude, longitude float64) {
+	return float64(k.Lat) / pointPrecision, float64(k.Lon) / pointPrecision
+}
+
+func (k PointKey) String() string {
+	return strconv.Itoa(int(k.Lat)) + ":" + strconv.Itoa(int(k.Lon))
+}
+
+// BudgetError запросы по координатам исчерпали свой лимит запросов к источнику
+type BudgetError struct {
+	RetryAfter time.Duration
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("point forecast budget exhausted, retry after %s", e.RetryAfter)
+}
+
+// PointForecasts прогноз по произвольным координатам, при промахе кэша прогноз запрашивается у источника,
+// одновременные запросы одной точки ждут один общий запрос к источнику.
+// У запросов по координатам свой лимит budget поверх общего лимита источника, при его исчерпании
+// запрос не ждёт, а сразу получает BudgetError, поэтому анонимные запросы не вытесняют обновление городов
+type PointForecasts struct {
+	provider openweather.ForecastProvider
+	cache    *Cache[PointKey, openweather.CityForecast]
+	group    singleflight.Group
+	budget   *ratelimit.Limiter
+	timeout  time.Duration
+}
+
+func NewPointForecasts(provider openweather.ForecastProvider, ttl time.Duration, budget ratelimit.Rate, timeout time.Duration) *PointForecasts {
+	return &PointForecasts{
+		provider: provider,
+		cache:    New[PointKey, openweather.CityForecast](ttl),
+		budget:   ratelimit.NewLimiter(budget),
+		timeout:  timeout,
+	}
+}
+
+// Forecast возвращает прогноз для точки key, cached true если прогноз взят из кэша
+func (p *PointForecasts) Forecast(ctx context.Context, key PointKey) (fc openweather.CityForecast, cached bool, err error) {
+	if fc, ok := p.cache.Get(key); ok {
+		return fc, true, nil
+	}
+
+	ch := p.group.DoChan(key.String(), func() (interface{}, error) {
+		if ok, wait := p.budget.Allow(); !ok {
+			return openweather.CityForecast{}, &BudgetError{RetryAfter: wait}
+		}
+
+		// запрос к источнику не прерывается, если отменён запрос пользователя, который его начал,
+		// его результат ждут и остальные пользователи, но и ждать источник дольше timeout он не будет
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.timeout)
+		defer cancel()
+
+		latitude, longitude := key.Coords()
+		fc, err := p.provider.FetchCityForecast(fetchCtx, latitude, longitude)
+		if err != nil {
+			return fc, err
+		}
+
+		p.cache.Set(key, fc)
+
+		return fc, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return fc, false, ctx.Err()
+	case res := <-ch:
+		return res.Val.(openweather.CityForecast), false, res.Err
+	}
+}
+
+func (p *PointForecasts) RegisterMetrics() {
+	p.cache.RegisterMetrics("point")
+}
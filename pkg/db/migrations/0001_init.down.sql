@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS forecasts;
+DROP TABLE IF EXISTS cities;
@@ -1,4 +1,6 @@
-CREATE TABLE cities (
+-- базовая схема, IF NOT EXISTS нужен для БД, созданных до появления миграций,
+-- когда схема применялась через docker-entrypoint-initdb.d
+CREATE TABLE IF NOT EXISTS cities (
     id serial primary key,
     city VARCHAR(100),
     latitude DOUBLE PRECISION NOT NULL,
@@ -6,7 +8,7 @@ CREATE TABLE cities (
     country VARCHAR(100)
 );
 
-CREATE TABLE forecasts (
+CREATE TABLE IF NOT EXISTS forecasts (
     id serial primary key,
     city_id INTEGER NOT NULL REFERENCES cities(id),
     date BIGINT NOT NULL,
@@ -14,4 +16,3 @@ CREATE TABLE forecasts (
     weather JSONB NOT NULL,
     UNIQUE (city_id, date)
 );
-
@@ -0,0 +1,7 @@
+ALTER TABLE forecasts DROP CONSTRAINT IF EXISTS forecasts_city_id_fkey;
+ALTER TABLE forecasts ADD CONSTRAINT forecasts_city_id_fkey
+    FOREIGN KEY (city_id) REFERENCES cities(id);
+
+DROP INDEX IF EXISTS cities_latitude_longitude_key;
+
+ALTER TABLE cities DROP COLUMN IF EXISTS disabled;
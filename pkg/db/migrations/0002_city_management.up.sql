@@ -0,0 +1,22 @@
+-- до появления уникальности по координатам каждый перезапуск сервиса добавлял города повторно,
+-- оставляем город с наименьшим id, прогнозы дублей удаляем
+DELETE FROM forecasts f
+USING cities c, cities keep
+WHERE f.city_id = c.id
+  AND keep.latitude = c.latitude
+  AND keep.longitude = c.longitude
+  AND keep.id < c.id;
+
+DELETE FROM cities c
+USING cities keep
+WHERE keep.latitude = c.latitude
+  AND keep.longitude = c.longitude
+  AND keep.id < c.id;
+
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT false;
+
+CREATE UNIQUE INDEX IF NOT EXISTS cities_latitude_longitude_key ON cities (latitude, longitude);
+
+ALTER TABLE forecasts DROP CONSTRAINT IF EXISTS forecasts_city_id_fkey;
+ALTER TABLE forecasts ADD CONSTRAINT forecasts_city_id_fkey
+    FOREIGN KEY (city_id) REFERENCES cities(id) ON DELETE CASCADE;
@@ -0,0 +1,15 @@
+-- каждая загрузка прогноза сохраняется отдельной ревизией: время выпуска прогноза и время, на которое он дан
+CREATE TABLE forecast_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    city_id INTEGER NOT NULL REFERENCES cities(id) ON DELETE CASCADE,
+    issued_at BIGINT NOT NULL,
+    date BIGINT NOT NULL,
+    temperature DOUBLE PRECISION NOT NULL,
+    weather JSONB NOT NULL,
+    UNIQUE (city_id, date, issued_at)
+);
+
+-- текущий прогноз становится первой ревизией
+INSERT INTO forecast_revisions(city_id, issued_at, date, temperature, weather)
+SELECT city_id, EXTRACT(EPOCH FROM now())::BIGINT, date, temperature, weather
+FROM forecasts;
@@ -0,0 +1,4 @@
+ALTER TABLE cities
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS sunrise,
+    DROP COLUMN IF EXISTS sunset;
@@ -0,0 +1,5 @@
+-- сдвиг местного времени города от UTC в секундах, время восхода и заката из последнего прогноза
+ALTER TABLE cities
+    ADD COLUMN timezone INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN sunrise BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN sunset BIGINT NOT NULL DEFAULT 0;
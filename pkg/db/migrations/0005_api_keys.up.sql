@@ -0,0 +1,21 @@
+-- ключи API хранятся только в виде sha256, сам ключ показывается один раз при создании,
+-- по prefix ключ можно узнать в списке, квота 0 значит без ограничения
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash BYTEA NOT NULL UNIQUE,
+    is_admin BOOLEAN NOT NULL DEFAULT false,
+    daily_quota INTEGER NOT NULL DEFAULT 0,
+    monthly_quota INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+-- количество запросов по ключу за каждый день (UTC), месячное использование - сумма по дням месяца
+CREATE TABLE api_key_usage (
+    key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (key_id, day)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE cities
+    DROP COLUMN IF EXISTS forecast_updated_at;
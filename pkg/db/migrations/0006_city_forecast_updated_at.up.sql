@@ -0,0 +1,4 @@
+-- время последней записи прогноза по городу, для ETag и Last-Modified в ответах API,
+-- пустое пока прогноз по городу не загружен после обновления
+ALTER TABLE cities
+    ADD COLUMN forecast_updated_at TIMESTAMPTZ;
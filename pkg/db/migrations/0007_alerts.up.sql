@@ -0,0 +1,30 @@
+-- правила оповещений по городу: поле прогноза field сравнивается с порогом threshold оператором operator
+-- на записях прогноза в ближайшие lookahead_hours часов, порог в единицах БД: кельвины и м/с
+CREATE TABLE alert_rules (
+    id SERIAL PRIMARY KEY,
+    city_id INTEGER NOT NULL REFERENCES cities(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    operator TEXT NOT NULL CHECK (operator IN ('lt', 'lte', 'gt', 'gte')),
+    threshold DOUBLE PRECISION NOT NULL,
+    lookahead_hours INTEGER NOT NULL DEFAULT 24 CHECK (lookahead_hours > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX alert_rules_city_id_idx ON alert_rules (city_id);
+
+-- события оповещений: событие открывается, когда прогноз пересекает порог правила, и снимается (resolved_at),
+-- когда перестаёт, forecast_date и value - время и значение самой сильной записи прогноза на момент срабатывания
+CREATE TABLE alert_events (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    city_id INTEGER NOT NULL REFERENCES cities(id) ON DELETE CASCADE,
+    forecast_date BIGINT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    triggered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ
+);
+
+-- не больше одного открытого события по правилу, повторные срабатывания не дублируются
+CREATE UNIQUE INDEX alert_events_active_rule_idx ON alert_events (rule_id) WHERE resolved_at IS NULL;
+
+CREATE INDEX alert_events_triggered_at_idx ON alert_events (triggered_at DESC);
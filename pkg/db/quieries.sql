@@ -10,24 +10,277 @@ VALUES ($1, $2, $3, $4)
 ON CONFLICT (city_id, date) 
 DO UPDATE SET temperature = EXCLUDED.temperature, weather = EXCLUDED.weather;
 
+-- name: NewForecastRevision :exec
+-- каждая загрузка прогноза сохраняется отдельной ревизией со временем загрузки, даже если прогноз не изменился
+INSERT INTO forecast_revisions(city_id, issued_at, date, temperature, weather)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (city_id, date, issued_at) DO NOTHING;
+
 -- name: CitiesList :many
-SELECT id, city, latitude, longitude, country
+SELECT id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
 FROM cities
 ORDER BY city;
 
+-- name: EnabledCities :many
+SELECT id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
+FROM cities
+WHERE NOT disabled
+ORDER BY id;
+
+-- name: CitiesCount :one
+SELECT COUNT(*)
+FROM cities;
+
+-- name: DeleteCity :execrows
+DELETE FROM cities
+WHERE id = $1;
+
+-- name: SetCityDisabled :one
+UPDATE cities
+SET disabled = $2
+WHERE id = $1
+RETURNING id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at;
+
 -- name: City :one
-SELECT city, latitude, longitude, country
+SELECT city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
 FROM cities
 WHERE id = $1;
 
+-- name: UpdateCityTimezone :exec
+UPDATE cities
+SET timezone = $2, sunrise = $3, sunset = $4
+WHERE id = $1;
+
+-- name: SetCityForecastUpdated :exec
+-- время последней записи прогноза по городу, по нему API отвечает на условные запросы
+UPDATE cities
+SET forecast_updated_at = now()
+WHERE id = $1;
+
+-- name: NewestForecastUpdate :one
+-- время последней записи прогноза по любому городу, по нему /readyz проверяет свежесть прогноза
+SELECT MAX(forecast_updated_at) AS updated_at
+FROM cities;
+
 -- name: ShortFcastForCity :many
 SELECT f.city_id, f.date, f.temperature
 FROM forecasts f
-WHERE f.city_id = $1;
+WHERE f.city_id = $1
+ORDER BY f.date;
 
 -- name: FullFcastByTime :many
-SELECT f.date, f.temperature, f.weather
+-- ближайшие записи прогноза не позже и позже запрошенного времени,
+-- за пределами прогноза возвращается только одна запись
+SELECT b.date, b.temperature, b.weather
+FROM (
+    (SELECT f.date, f.temperature, f.weather
+    FROM forecasts f
+    WHERE f.city_id = $1 AND f.date <= $2
+    ORDER BY f.date DESC
+    LIMIT 1)
+    UNION ALL
+    (SELECT f.date, f.temperature, f.weather
+    FROM forecasts f
+    WHERE f.city_id = $1 AND f.date > $2
+    ORDER BY f.date
+    LIMIT 1)
+) b
+ORDER BY b.date;
+
+-- name: ForecastRange :many
+-- записи прогноза по городу с шагом 3 часа от date_from до date_to включительно
+SELECT f.date, f.weather
 FROM forecasts f
-WHERE f.city_id = $1
-ORDER BY ABS(f.date - $2)
-LIMIT 2;
\ No newline at end of file
+WHERE f.city_id = sqlc.arg(city_id) AND f.date >= sqlc.arg(date_from) AND f.date <= sqlc.arg(date_to)
+ORDER BY f.date;
+
+-- name: ForecastHistory :many
+-- ревизии на время, ближайшее к date, но не дальше max_distance секунд от него
+SELECT r.issued_at, r.date, r.temperature, r.weather
+FROM forecast_revisions r
+WHERE r.city_id = sqlc.arg(city_id)
+  AND r.date = (
+    SELECT n.date
+    FROM forecast_revisions n
+    WHERE n.city_id = sqlc.arg(city_id)
+      AND n.date BETWEEN sqlc.arg(date)::BIGINT - sqlc.arg(max_distance)::BIGINT
+          AND sqlc.arg(date)::BIGINT + sqlc.arg(max_distance)::BIGINT
+    ORDER BY ABS(n.date - sqlc.arg(date))
+    LIMIT 1
+  )
+ORDER BY r.issued_at;
+
+-- name: DailyFcastForCity :many
+-- сводка по календарным дням считается в БД из jsonb с полным прогнозом,
+-- границы дней по местному времени города, прошедшие дни не возвращаются.
+-- Осадки - сумма дождя и снега за день. Преобладающая погода - самый частый код погоды за день,
+-- описание и значок берутся из дневной записи с этим кодом, что бы день и ночь не делили погоду на разные группы
+WITH local_slots AS (
+    SELECT to_char(to_timestamp(f.date + c.timezone) AT TIME ZONE 'UTC', 'YYYY-MM-DD')::TEXT AS day,
+        f.date, f.temperature, f.weather->'ForecastData' AS data
+    FROM forecasts f
+    JOIN cities c ON c.id = f.city_id
+    WHERE f.city_id = $1
+      AND f.date >= (EXTRACT(EPOCH FROM now())::BIGINT + c.timezone) / 86400 * 86400 - c.timezone
+), days AS (
+    SELECT s.day,
+        COUNT(*) AS slots,
+        MIN((s.data->'main'->>'temp_min')::DOUBLE PRECISION)::DOUBLE PRECISION AS temp_min,
+        MAX((s.data->'main'->>'temp_max')::DOUBLE PRECISION)::DOUBLE PRECISION AS temp_max,
+        AVG(s.temperature)::DOUBLE PRECISION AS temp_mean,
+        COALESCE(SUM(COALESCE((s.data->'rain'->>'3h')::DOUBLE PRECISION, 0)
+            + COALESCE((s.data->'snow'->>'3h')::DOUBLE PRECISION, 0)), 0)::DOUBLE PRECISION AS precipitation,
+        COALESCE(MAX((s.data->'wind'->>'gust')::DOUBLE PRECISION), 0)::DOUBLE PRECISION AS max_gust,
+        COALESCE(MAX((s.data->>'pop')::DOUBLE PRECISION), 0)::DOUBLE PRECISION AS max_pop,
+        MODE() WITHIN GROUP (ORDER BY s.data->'weather'->0->>'id') AS condition_id
+    FROM local_slots s
+    GROUP BY s.day
+)
+SELECT d.day, d.slots, d.temp_min, d.temp_max, d.temp_mean, d.precipitation, d.max_gust, d.max_pop,
+    COALESCE(w.condition->>'main', '')::TEXT AS condition,
+    COALESCE(w.condition->>'description', '')::TEXT AS description,
+    COALESCE(w.condition->>'icon', '')::TEXT AS icon
+FROM days d
+LEFT JOIN LATERAL (
+    SELECT s.data->'weather'->0 AS condition
+    FROM local_slots s
+    WHERE s.day = d.day AND s.data->'weather'->0->>'id' = d.condition_id
+    ORDER BY s.data->'sys'->>'pod' = 'd' DESC NULLS LAST, s.date
+    LIMIT 1
+) w ON true
+ORDER BY d.day;
+
+-- name: ShortFcastForCities :many
+-- краткий прогноз сразу по нескольким городам, город без прогноза возвращается одной строкой с пустыми date и temperature
+SELECT c.id, c.city, c.latitude, c.longitude, c.country, c.timezone, c.sunrise, c.sunset,
+    f.date, f.temperature
+FROM cities c
+LEFT JOIN forecasts f ON f.city_id = c.id
+WHERE c.id = ANY(sqlc.arg(city_ids)::INTEGER[])
+ORDER BY c.id, f.date;
+
+-- name: FullFcastForCities :many
+-- ближайшие записи прогноза до и после запрошенного времени сразу по нескольким городам,
+-- если local, то время date местное и для каждого города сдвигается на его часовой пояс
+SELECT c.id, c.city, c.latitude, c.longitude, c.country, c.timezone, c.sunrise, c.sunset,
+    b.date, COALESCE(b.weather, 'null'::JSONB)::JSONB AS weather
+FROM cities c
+LEFT JOIN LATERAL (
+    (SELECT f.date, f.weather
+    FROM forecasts f
+    WHERE f.city_id = c.id
+      AND f.date <= sqlc.arg(date)::BIGINT - CASE WHEN sqlc.arg(local)::BOOLEAN THEN c.timezone ELSE 0 END
+    ORDER BY f.date DESC
+    LIMIT 1)
+    UNION ALL
+    (SELECT f.date, f.weather
+    FROM forecasts f
+    WHERE f.city_id = c.id
+      AND f.date > sqlc.arg(date)::BIGINT - CASE WHEN sqlc.arg(local)::BOOLEAN THEN c.timezone ELSE 0 END
+    ORDER BY f.date
+    LIMIT 1)
+) b ON true
+WHERE c.id = ANY(sqlc.arg(city_ids)::INTEGER[])
+ORDER BY c.id, b.date;
+
+-- name: NearestCities :many
+-- города не дальше radius_km от точки по расстоянию на сфере (формула гаверсинусов),
+-- прямоугольник min_lat..max_lat, min_lon..max_lon отсекает дальние города по индексу по координатам
+SELECT n.id, n.city, n.latitude, n.longitude, n.country, n.distance_km
+FROM (
+    SELECT c.id, c.city, c.latitude, c.longitude, c.country,
+        (2 * 6371.0088 * ASIN(LEAST(1, SQRT(
+            POWER(SIN(RADIANS(c.latitude - sqlc.arg(lat)::DOUBLE PRECISION) / 2), 2) +
+            COS(RADIANS(sqlc.arg(lat)::DOUBLE PRECISION)) * COS(RADIANS(c.latitude)) *
+            POWER(SIN(RADIANS(c.longitude - sqlc.arg(lon)::DOUBLE PRECISION) / 2), 2)
+        ))))::DOUBLE PRECISION AS distance_km
+    FROM cities c
+    WHERE c.latitude BETWEEN sqlc.arg(min_lat)::DOUBLE PRECISION AND sqlc.arg(max_lat)::DOUBLE PRECISION
+      AND c.longitude BETWEEN sqlc.arg(min_lon)::DOUBLE PRECISION AND sqlc.arg(max_lon)::DOUBLE PRECISION
+) n
+WHERE n.distance_km <= sqlc.arg(radius_km)::DOUBLE PRECISION
+ORDER BY n.distance_km
+LIMIT sqlc.arg(max_results)::INTEGER;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys(name, prefix, key_hash, is_admin, daily_quota, monthly_quota)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, name, prefix, key_hash, is_admin, daily_quota, monthly_quota, created_at, revoked_at;
+
+-- name: APIKeyByHash :one
+SELECT id, name, prefix, key_hash, is_admin, daily_quota, monthly_quota, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL;
+
+-- name: ListAPIKeys :many
+-- ключи вместе с количеством запросов за день day и за месяц этого дня
+SELECT k.id, k.name, k.prefix, k.is_admin, k.daily_quota, k.monthly_quota, k.created_at, k.revoked_at,
+    COALESCE(SUM(u.requests) FILTER (WHERE u.day = sqlc.arg(day)::DATE), 0)::BIGINT AS daily_requests,
+    COALESCE(SUM(u.requests), 0)::BIGINT AS monthly_requests
+FROM api_keys k
+LEFT JOIN api_key_usage u ON u.key_id = k.id
+    AND u.day >= date_trunc('month', sqlc.arg(day)::DATE)::DATE
+    AND u.day <= sqlc.arg(day)::DATE
+GROUP BY k.id
+ORDER BY k.id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: UseAPIKey :one
+-- учитывает запрос по ключу за день day и возвращает количество запросов за этот день и за месяц этого дня
+WITH today AS (
+    INSERT INTO api_key_usage(key_id, day, requests)
+    VALUES (sqlc.arg(key_id), sqlc.arg(day)::DATE, 1)
+    ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+    RETURNING requests
+)
+SELECT t.requests AS daily_requests,
+    (t.requests + COALESCE((
+        SELECT SUM(u.requests)
+        FROM api_key_usage u
+        WHERE u.key_id = sqlc.arg(key_id)
+          AND u.day >= date_trunc('month', sqlc.arg(day)::DATE)::DATE
+          AND u.day < sqlc.arg(day)::DATE
+    ), 0))::BIGINT AS monthly_requests
+FROM today t;
+
+-- name: CreateAlertRule :one
+INSERT INTO alert_rules(city_id, field, operator, threshold, lookahead_hours)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, city_id, field, operator, threshold, lookahead_hours, created_at;
+
+-- name: AlertRules :many
+-- правила по городу, city_id 0 - по всем городам
+SELECT id, city_id, field, operator, threshold, lookahead_hours, created_at
+FROM alert_rules
+WHERE sqlc.arg(city_id)::INTEGER = 0 OR city_id = sqlc.arg(city_id)::INTEGER
+ORDER BY id;
+
+-- name: DeleteAlertRule :execrows
+DELETE FROM alert_rules
+WHERE id = $1;
+
+-- name: TriggerAlert :execrows
+-- открывает событие по правилу, если открытого ещё нет, повторное срабатывание ничего не меняет
+INSERT INTO alert_events(rule_id, city_id, forecast_date, value)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (rule_id) WHERE resolved_at IS NULL DO NOTHING;
+
+-- name: ResolveAlert :execrows
+UPDATE alert_events
+SET resolved_at = now()
+WHERE rule_id = $1 AND resolved_at IS NULL;
+
+-- name: AlertEvents :many
+-- события от новых к старым вместе с правилом, city_id 0 - по всем городам, active - только открытые
+SELECT e.id, e.rule_id, e.city_id, e.forecast_date, e.value, e.triggered_at, e.resolved_at,
+    r.field, r.operator, r.threshold, r.lookahead_hours
+FROM alert_events e
+JOIN alert_rules r ON r.id = e.rule_id
+WHERE (sqlc.arg(city_id)::INTEGER = 0 OR e.city_id = sqlc.arg(city_id)::INTEGER)
+  AND (NOT sqlc.arg(active)::BOOLEAN OR e.resolved_at IS NULL)
+ORDER BY e.triggered_at DESC, e.id DESC
+LIMIT sqlc.arg(max_results)::INTEGER;
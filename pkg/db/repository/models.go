@@ -7,14 +7,58 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"time"
 )
 
+type AlertEvent struct {
+	ID           int64
+	RuleID       int32
+	CityID       int32
+	ForecastDate int64
+	Value        float64
+	TriggeredAt  time.Time
+	ResolvedAt   sql.NullTime
+}
+
+type AlertRule struct {
+	ID             int32
+	CityID         int32
+	Field          string
+	Operator       string
+	Threshold      float64
+	LookaheadHours int32
+	CreatedAt      time.Time
+}
+
+type ApiKey struct {
+	ID           int32
+	Name         string
+	Prefix       string
+	KeyHash      []byte
+	IsAdmin      bool
+	DailyQuota   int32
+	MonthlyQuota int32
+	CreatedAt    time.Time
+	RevokedAt    sql.NullTime
+}
+
+type ApiKeyUsage struct {
+	KeyID    int32
+	Day      time.Time
+	Requests int64
+}
+
 type City struct {
-	ID        int32
-	City      sql.NullString
-	Latitude  float64
-	Longitude float64
-	Country   sql.NullString
+	ID                int32
+	City              sql.NullString
+	Latitude          float64
+	Longitude         float64
+	Country           sql.NullString
+	Disabled          bool
+	Timezone          int32
+	Sunrise           int64
+	Sunset            int64
+	ForecastUpdatedAt sql.NullTime
 }
 
 type Forecast struct {
@@ -24,3 +68,12 @@ type Forecast struct {
 	Temperature float64
 	Weather     json.RawMessage
 }
+
+type ForecastRevision struct {
+	ID          int64
+	CityID      int32
+	IssuedAt    int64
+	Date        int64
+	Temperature float64
+	Weather     json.RawMessage
+}
@@ -9,10 +9,154 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const aPIKeyByHash = `-- name: APIKeyByHash :one
+SELECT id, name, prefix, key_hash, is_admin, daily_quota, monthly_quota, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) APIKeyByHash(ctx context.Context, keyHash []byte) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, aPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.IsAdmin,
+		&i.DailyQuota,
+		&i.MonthlyQuota,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const alertEvents = `-- name: AlertEvents :many
+SELECT e.id, e.rule_id, e.city_id, e.forecast_date, e.value, e.triggered_at, e.resolved_at,
+    r.field, r.operator, r.threshold, r.lookahead_hours
+FROM alert_events e
+JOIN alert_rules r ON r.id = e.rule_id
+WHERE ($1::INTEGER = 0 OR e.city_id = $1::INTEGER)
+  AND (NOT $2::BOOLEAN OR e.resolved_at IS NULL)
+ORDER BY e.triggered_at DESC, e.id DESC
+LIMIT $3::INTEGER
+`
+
+type AlertEventsParams struct {
+	CityID     int32
+	Active     bool
+	MaxResults int32
+}
+
+type AlertEventsRow struct {
+	ID             int64
+	RuleID         int32
+	CityID         int32
+	ForecastDate   int64
+	Value          float64
+	TriggeredAt    time.Time
+	ResolvedAt     sql.NullTime
+	Field          string
+	Operator       string
+	Threshold      float64
+	LookaheadHours int32
+}
+
+// события от новых к старым вместе с правилом, city_id 0 - по всем городам, active - только открытые
+func (q *Queries) AlertEvents(ctx context.Context, arg AlertEventsParams) ([]AlertEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, alertEvents, arg.CityID, arg.Active, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AlertEventsRow
+	for rows.Next() {
+		var i AlertEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RuleID,
+			&i.CityID,
+			&i.ForecastDate,
+			&i.Value,
+			&i.TriggeredAt,
+			&i.ResolvedAt,
+			&i.Field,
+			&i.Operator,
+			&i.Threshold,
+			&i.LookaheadHours,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const alertRules = `-- name: AlertRules :many
+SELECT id, city_id, field, operator, threshold, lookahead_hours, created_at
+FROM alert_rules
+WHERE $1::INTEGER = 0 OR city_id = $1::INTEGER
+ORDER BY id
+`
+
+// правила по городу, city_id 0 - по всем городам
+func (q *Queries) AlertRules(ctx context.Context, cityID int32) ([]AlertRule, error) {
+	rows, err := q.db.QueryContext(ctx, alertRules, cityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AlertRule
+	for rows.Next() {
+		var i AlertRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.CityID,
+			&i.Field,
+			&i.Operator,
+			&i.Threshold,
+			&i.LookaheadHours,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const citiesCount = `-- name: CitiesCount :one
+SELECT COUNT(*)
+FROM cities
+`
+
+func (q *Queries) CitiesCount(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, citiesCount)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const citiesList = `-- name: CitiesList :many
-SELECT id, city, latitude, longitude, country
+SELECT id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
 FROM cities
 ORDER BY city
 `
@@ -32,6 +176,11 @@ func (q *Queries) CitiesList(ctx context.Context) ([]City, error) {
 			&i.Latitude,
 			&i.Longitude,
 			&i.Country,
+			&i.Disabled,
+			&i.Timezone,
+			&i.Sunrise,
+			&i.Sunset,
+			&i.ForecastUpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -47,16 +196,21 @@ func (q *Queries) CitiesList(ctx context.Context) ([]City, error) {
 }
 
 const city = `-- name: City :one
-SELECT city, latitude, longitude, country
+SELECT city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
 FROM cities
 WHERE id = $1
 `
 
 type CityRow struct {
-	City      sql.NullString
-	Latitude  float64
-	Longitude float64
-	Country   sql.NullString
+	City              sql.NullString
+	Latitude          float64
+	Longitude         float64
+	Country           sql.NullString
+	Disabled          bool
+	Timezone          int32
+	Sunrise           int64
+	Sunset            int64
+	ForecastUpdatedAt sql.NullTime
 }
 
 func (q *Queries) City(ctx context.Context, id int32) (CityRow, error) {
@@ -67,16 +221,362 @@ func (q *Queries) City(ctx context.Context, id int32) (CityRow, error) {
 		&i.Latitude,
 		&i.Longitude,
 		&i.Country,
+		&i.Disabled,
+		&i.Timezone,
+		&i.Sunrise,
+		&i.Sunset,
+		&i.ForecastUpdatedAt,
 	)
 	return i, err
 }
 
-const fullFcastByTime = `-- name: FullFcastByTime :many
-SELECT f.date, f.temperature, f.weather
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys(name, prefix, key_hash, is_admin, daily_quota, monthly_quota)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, name, prefix, key_hash, is_admin, daily_quota, monthly_quota, created_at, revoked_at
+`
+
+type CreateAPIKeyParams struct {
+	Name         string
+	Prefix       string
+	KeyHash      []byte
+	IsAdmin      bool
+	DailyQuota   int32
+	MonthlyQuota int32
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, createAPIKey,
+		arg.Name,
+		arg.Prefix,
+		arg.KeyHash,
+		arg.IsAdmin,
+		arg.DailyQuota,
+		arg.MonthlyQuota,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.IsAdmin,
+		&i.DailyQuota,
+		&i.MonthlyQuota,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const createAlertRule = `-- name: CreateAlertRule :one
+INSERT INTO alert_rules(city_id, field, operator, threshold, lookahead_hours)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, city_id, field, operator, threshold, lookahead_hours, created_at
+`
+
+type CreateAlertRuleParams struct {
+	CityID         int32
+	Field          string
+	Operator       string
+	Threshold      float64
+	LookaheadHours int32
+}
+
+func (q *Queries) CreateAlertRule(ctx context.Context, arg CreateAlertRuleParams) (AlertRule, error) {
+	row := q.db.QueryRowContext(ctx, createAlertRule,
+		arg.CityID,
+		arg.Field,
+		arg.Operator,
+		arg.Threshold,
+		arg.LookaheadHours,
+	)
+	var i AlertRule
+	err := row.Scan(
+		&i.ID,
+		&i.CityID,
+		&i.Field,
+		&i.Operator,
+		&i.Threshold,
+		&i.LookaheadHours,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const dailyFcastForCity = `-- name: DailyFcastForCity :many
+WITH local_slots AS (
+    SELECT to_char(to_timestamp(f.date + c.timezone) AT TIME ZONE 'UTC', 'YYYY-MM-DD')::TEXT AS day,
+        f.date, f.temperature, f.weather->'ForecastData' AS data
+    FROM forecasts f
+    JOIN cities c ON c.id = f.city_id
+    WHERE f.city_id = $1
+      AND f.date >= (EXTRACT(EPOCH FROM now())::BIGINT + c.timezone) / 86400 * 86400 - c.timezone
+), days AS (
+    SELECT s.day,
+        COUNT(*) AS slots,
+        MIN((s.data->'main'->>'temp_min')::DOUBLE PRECISION)::DOUBLE PRECISION AS temp_min,
+        MAX((s.data->'main'->>'temp_max')::DOUBLE PRECISION)::DOUBLE PRECISION AS temp_max,
+        AVG(s.temperature)::DOUBLE PRECISION AS temp_mean,
+        COALESCE(SUM(COALESCE((s.data->'rain'->>'3h')::DOUBLE PRECISION, 0)
+            + COALESCE((s.data->'snow'->>'3h')::DOUBLE PRECISION, 0)), 0)::DOUBLE PRECISION AS precipitation,
+        COALESCE(MAX((s.data->'wind'->>'gust')::DOUBLE PRECISION), 0)::DOUBLE PRECISION AS max_gust,
+        COALESCE(MAX((s.data->>'pop')::DOUBLE PRECISION), 0)::DOUBLE PRECISION AS max_pop,
+        MODE() WITHIN GROUP (ORDER BY s.data->'weather'->0->>'id') AS condition_id
+    FROM local_slots s
+    GROUP BY s.day
+)
+SELECT d.day, d.slots, d.temp_min, d.temp_max, d.temp_mean, d.precipitation, d.max_gust, d.max_pop,
+    COALESCE(w.condition->>'main', '')::TEXT AS condition,
+    COALESCE(w.condition->>'description', '')::TEXT AS description,
+    COALESCE(w.condition->>'icon', '')::TEXT AS icon
+FROM days d
+LEFT JOIN LATERAL (
+    SELECT s.data->'weather'->0 AS condition
+    FROM local_slots s
+    WHERE s.day = d.day AND s.data->'weather'->0->>'id' = d.condition_id
+    ORDER BY s.data->'sys'->>'pod' = 'd' DESC NULLS LAST, s.date
+    LIMIT 1
+) w ON true
+ORDER BY d.day
+`
+
+type DailyFcastForCityRow struct {
+	Day           string
+	Slots         int64
+	TempMin       float64
+	TempMax       float64
+	TempMean      float64
+	Precipitation float64
+	MaxGust       float64
+	MaxPop        float64
+	Condition     string
+	Description   string
+	Icon          string
+}
+
+// сводка по календарным дням считается в БД из jsonb с полным прогнозом,
+// границы дней по местному времени города, прошедшие дни не возвращаются.
+// Осадки - сумма дождя и снега за день. Преобладающая погода - самый частый код погоды за день,
+// описание и значок берутся из дневной записи с этим кодом, что бы день и ночь не делили погоду на разные группы
+func (q *Queries) DailyFcastForCity(ctx context.Context, cityID int32) ([]DailyFcastForCityRow, error) {
+	rows, err := q.db.QueryContext(ctx, dailyFcastForCity, cityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DailyFcastForCityRow
+	for rows.Next() {
+		var i DailyFcastForCityRow
+		if err := rows.Scan(
+			&i.Day,
+			&i.Slots,
+			&i.TempMin,
+			&i.TempMax,
+			&i.TempMean,
+			&i.Precipitation,
+			&i.MaxGust,
+			&i.MaxPop,
+			&i.Condition,
+			&i.Description,
+			&i.Icon,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteAlertRule = `-- name: DeleteAlertRule :execrows
+DELETE FROM alert_rules
+WHERE id = $1
+`
+
+func (q *Queries) DeleteAlertRule(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAlertRule, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteCity = `-- name: DeleteCity :execrows
+DELETE FROM cities
+WHERE id = $1
+`
+
+func (q *Queries) DeleteCity(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCity, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enabledCities = `-- name: EnabledCities :many
+SELECT id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
+FROM cities
+WHERE NOT disabled
+ORDER BY id
+`
+
+func (q *Queries) EnabledCities(ctx context.Context) ([]City, error) {
+	rows, err := q.db.QueryContext(ctx, enabledCities)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []City
+	for rows.Next() {
+		var i City
+		if err := rows.Scan(
+			&i.ID,
+			&i.City,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Country,
+			&i.Disabled,
+			&i.Timezone,
+			&i.Sunrise,
+			&i.Sunset,
+			&i.ForecastUpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const forecastHistory = `-- name: ForecastHistory :many
+SELECT r.issued_at, r.date, r.temperature, r.weather
+FROM forecast_revisions r
+WHERE r.city_id = $1
+  AND r.date = (
+    SELECT n.date
+    FROM forecast_revisions n
+    WHERE n.city_id = $1
+      AND n.date BETWEEN $2::BIGINT - $3::BIGINT
+          AND $2::BIGINT + $3::BIGINT
+    ORDER BY ABS(n.date - $2)
+    LIMIT 1
+  )
+ORDER BY r.issued_at
+`
+
+type ForecastHistoryParams struct {
+	CityID      int32
+	Date        int64
+	MaxDistance int64
+}
+
+type ForecastHistoryRow struct {
+	IssuedAt    int64
+	Date        int64
+	Temperature float64
+	Weather     json.RawMessage
+}
+
+// ревизии на время, ближайшее к date, но не дальше max_distance секунд от него
+func (q *Queries) ForecastHistory(ctx context.Context, arg ForecastHistoryParams) ([]ForecastHistoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, forecastHistory, arg.CityID, arg.Date, arg.MaxDistance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ForecastHistoryRow
+	for rows.Next() {
+		var i ForecastHistoryRow
+		if err := rows.Scan(
+			&i.IssuedAt,
+			&i.Date,
+			&i.Temperature,
+			&i.Weather,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const forecastRange = `-- name: ForecastRange :many
+SELECT f.date, f.weather
 FROM forecasts f
-WHERE f.city_id = $1
-ORDER BY ABS(f.date - $2)
-LIMIT 2
+WHERE f.city_id = $1 AND f.date >= $2 AND f.date <= $3
+ORDER BY f.date
+`
+
+type ForecastRangeParams struct {
+	CityID   int32
+	DateFrom int64
+	DateTo   int64
+}
+
+type ForecastRangeRow struct {
+	Date    int64
+	Weather json.RawMessage
+}
+
+// записи прогноза по городу с шагом 3 часа от date_from до date_to включительно
+func (q *Queries) ForecastRange(ctx context.Context, arg ForecastRangeParams) ([]ForecastRangeRow, error) {
+	rows, err := q.db.QueryContext(ctx, forecastRange, arg.CityID, arg.DateFrom, arg.DateTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ForecastRangeRow
+	for rows.Next() {
+		var i ForecastRangeRow
+		if err := rows.Scan(&i.Date, &i.Weather); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fullFcastByTime = `-- name: FullFcastByTime :many
+SELECT b.date, b.temperature, b.weather
+FROM (
+    (SELECT f.date, f.temperature, f.weather
+    FROM forecasts f
+    WHERE f.city_id = $1 AND f.date <= $2
+    ORDER BY f.date DESC
+    LIMIT 1)
+    UNION ALL
+    (SELECT f.date, f.temperature, f.weather
+    FROM forecasts f
+    WHERE f.city_id = $1 AND f.date > $2
+    ORDER BY f.date
+    LIMIT 1)
+) b
+ORDER BY b.date
 `
 
 type FullFcastByTimeParams struct {
@@ -90,6 +590,8 @@ type FullFcastByTimeRow struct {
 	Weather     json.RawMessage
 }
 
+// ближайшие записи прогноза не позже и позже запрошенного времени,
+// за пределами прогноза возвращается только одна запись
 func (q *Queries) FullFcastByTime(ctx context.Context, arg FullFcastByTimeParams) ([]FullFcastByTimeRow, error) {
 	rows, err := q.db.QueryContext(ctx, fullFcastByTime, arg.CityID, arg.Date)
 	if err != nil {
@@ -113,6 +615,223 @@ func (q *Queries) FullFcastByTime(ctx context.Context, arg FullFcastByTimeParams
 	return items, nil
 }
 
+const fullFcastForCities = `-- name: FullFcastForCities :many
+SELECT c.id, c.city, c.latitude, c.longitude, c.country, c.timezone, c.sunrise, c.sunset,
+    b.date, COALESCE(b.weather, 'null'::JSONB)::JSONB AS weather
+FROM cities c
+LEFT JOIN LATERAL (
+    (SELECT f.date, f.weather
+    FROM forecasts f
+    WHERE f.city_id = c.id
+      AND f.date <= $1::BIGINT - CASE WHEN $2::BOOLEAN THEN c.timezone ELSE 0 END
+    ORDER BY f.date DESC
+    LIMIT 1)
+    UNION ALL
+    (SELECT f.date, f.weather
+    FROM forecasts f
+    WHERE f.city_id = c.id
+      AND f.date > $1::BIGINT - CASE WHEN $2::BOOLEAN THEN c.timezone ELSE 0 END
+    ORDER BY f.date
+    LIMIT 1)
+) b ON true
+WHERE c.id = ANY($3::INTEGER[])
+ORDER BY c.id, b.date
+`
+
+type FullFcastForCitiesParams struct {
+	Date    int64
+	Local   bool
+	CityIds []int32
+}
+
+type FullFcastForCitiesRow struct {
+	ID        int32
+	City      sql.NullString
+	Latitude  float64
+	Longitude float64
+	Country   sql.NullString
+	Timezone  int32
+	Sunrise   int64
+	Sunset    int64
+	Date      sql.NullInt64
+	Weather   json.RawMessage
+}
+
+// ближайшие записи прогноза до и после запрошенного времени сразу по нескольким городам,
+// если local, то время date местное и для каждого города сдвигается на его часовой пояс
+func (q *Queries) FullFcastForCities(ctx context.Context, arg FullFcastForCitiesParams) ([]FullFcastForCitiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, fullFcastForCities, arg.Date, arg.Local, pq.Array(arg.CityIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FullFcastForCitiesRow
+	for rows.Next() {
+		var i FullFcastForCitiesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.City,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Country,
+			&i.Timezone,
+			&i.Sunrise,
+			&i.Sunset,
+			&i.Date,
+			&i.Weather,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT k.id, k.name, k.prefix, k.is_admin, k.daily_quota, k.monthly_quota, k.created_at, k.revoked_at,
+    COALESCE(SUM(u.requests) FILTER (WHERE u.day = $1::DATE), 0)::BIGINT AS daily_requests,
+    COALESCE(SUM(u.requests), 0)::BIGINT AS monthly_requests
+FROM api_keys k
+LEFT JOIN api_key_usage u ON u.key_id = k.id
+    AND u.day >= date_trunc('month', $1::DATE)::DATE
+    AND u.day <= $1::DATE
+GROUP BY k.id
+ORDER BY k.id
+`
+
+type ListAPIKeysRow struct {
+	ID              int32
+	Name            string
+	Prefix          string
+	IsAdmin         bool
+	DailyQuota      int32
+	MonthlyQuota    int32
+	CreatedAt       time.Time
+	RevokedAt       sql.NullTime
+	DailyRequests   int64
+	MonthlyRequests int64
+}
+
+// ключи вместе с количеством запросов за день day и за месяц этого дня
+func (q *Queries) ListAPIKeys(ctx context.Context, day time.Time) ([]ListAPIKeysRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAPIKeys, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAPIKeysRow
+	for rows.Next() {
+		var i ListAPIKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.IsAdmin,
+			&i.DailyQuota,
+			&i.MonthlyQuota,
+			&i.CreatedAt,
+			&i.RevokedAt,
+			&i.DailyRequests,
+			&i.MonthlyRequests,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const nearestCities = `-- name: NearestCities :many
+SELECT n.id, n.city, n.latitude, n.longitude, n.country, n.distance_km
+FROM (
+    SELECT c.id, c.city, c.latitude, c.longitude, c.country,
+        (2 * 6371.0088 * ASIN(LEAST(1, SQRT(
+            POWER(SIN(RADIANS(c.latitude - $1::DOUBLE PRECISION) / 2), 2) +
+            COS(RADIANS($1::DOUBLE PRECISION)) * COS(RADIANS(c.latitude)) *
+            POWER(SIN(RADIANS(c.longitude - $2::DOUBLE PRECISION) / 2), 2)
+        ))))::DOUBLE PRECISION AS distance_km
+    FROM cities c
+    WHERE c.latitude BETWEEN $3::DOUBLE PRECISION AND $4::DOUBLE PRECISION
+      AND c.longitude BETWEEN $5::DOUBLE PRECISION AND $6::DOUBLE PRECISION
+) n
+WHERE n.distance_km <= $7::DOUBLE PRECISION
+ORDER BY n.distance_km
+LIMIT $8::INTEGER
+`
+
+type NearestCitiesParams struct {
+	Lat        float64
+	Lon        float64
+	MinLat     float64
+	MaxLat     float64
+	MinLon     float64
+	MaxLon     float64
+	RadiusKm   float64
+	MaxResults int32
+}
+
+type NearestCitiesRow struct {
+	ID         int32
+	City       sql.NullString
+	Latitude   float64
+	Longitude  float64
+	Country    sql.NullString
+	DistanceKm float64
+}
+
+// города не дальше radius_km от точки по расстоянию на сфере (формула гаверсинусов),
+// прямоугольник min_lat..max_lat, min_lon..max_lon отсекает дальние города по индексу по координатам
+func (q *Queries) NearestCities(ctx context.Context, arg NearestCitiesParams) ([]NearestCitiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, nearestCities,
+		arg.Lat,
+		arg.Lon,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLon,
+		arg.MaxLon,
+		arg.RadiusKm,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []NearestCitiesRow
+	for rows.Next() {
+		var i NearestCitiesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.City,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Country,
+			&i.DistanceKm,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const newCitiesList = `-- name: NewCitiesList :one
 INSERT INTO cities(city, latitude, longitude, country) 
 VALUES ($1, $2, $3, $4)
@@ -163,10 +882,177 @@ func (q *Queries) NewForecast(ctx context.Context, arg NewForecastParams) error
 	return err
 }
 
+const newForecastRevision = `-- name: NewForecastRevision :exec
+INSERT INTO forecast_revisions(city_id, issued_at, date, temperature, weather)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (city_id, date, issued_at) DO NOTHING
+`
+
+type NewForecastRevisionParams struct {
+	CityID      int32
+	IssuedAt    int64
+	Date        int64
+	Temperature float64
+	Weather     json.RawMessage
+}
+
+// каждая загрузка прогноза сохраняется отдельной ревизией со временем загрузки, даже если прогноз не изменился
+func (q *Queries) NewForecastRevision(ctx context.Context, arg NewForecastRevisionParams) error {
+	_, err := q.db.ExecContext(ctx, newForecastRevision,
+		arg.CityID,
+		arg.IssuedAt,
+		arg.Date,
+		arg.Temperature,
+		arg.Weather,
+	)
+	return err
+}
+
+const newestForecastUpdate = `-- name: NewestForecastUpdate :one
+SELECT MAX(forecast_updated_at) AS updated_at
+FROM cities
+`
+
+// время последней записи прогноза по любому городу, по нему /readyz проверяет свежесть прогноза
+func (q *Queries) NewestForecastUpdate(ctx context.Context) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, newestForecastUpdate)
+	var updated_at sql.NullTime
+	err := row.Scan(&updated_at)
+	return updated_at, err
+}
+
+const resolveAlert = `-- name: ResolveAlert :execrows
+UPDATE alert_events
+SET resolved_at = now()
+WHERE rule_id = $1 AND resolved_at IS NULL
+`
+
+func (q *Queries) ResolveAlert(ctx context.Context, ruleID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resolveAlert, ruleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAPIKey, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setCityDisabled = `-- name: SetCityDisabled :one
+UPDATE cities
+SET disabled = $2
+WHERE id = $1
+RETURNING id, city, latitude, longitude, country, disabled, timezone, sunrise, sunset, forecast_updated_at
+`
+
+type SetCityDisabledParams struct {
+	ID       int32
+	Disabled bool
+}
+
+func (q *Queries) SetCityDisabled(ctx context.Context, arg SetCityDisabledParams) (City, error) {
+	row := q.db.QueryRowContext(ctx, setCityDisabled, arg.ID, arg.Disabled)
+	var i City
+	err := row.Scan(
+		&i.ID,
+		&i.City,
+		&i.Latitude,
+		&i.Longitude,
+		&i.Country,
+		&i.Disabled,
+		&i.Timezone,
+		&i.Sunrise,
+		&i.Sunset,
+		&i.ForecastUpdatedAt,
+	)
+	return i, err
+}
+
+const setCityForecastUpdated = `-- name: SetCityForecastUpdated :exec
+UPDATE cities
+SET forecast_updated_at = now()
+WHERE id = $1
+`
+
+// время последней записи прогноза по городу, по нему API отвечает на условные запросы
+func (q *Queries) SetCityForecastUpdated(ctx context.Context, id int32) error {
+	_, err := q.db.ExecContext(ctx, setCityForecastUpdated, id)
+	return err
+}
+
+const shortFcastForCities = `-- name: ShortFcastForCities :many
+SELECT c.id, c.city, c.latitude, c.longitude, c.country, c.timezone, c.sunrise, c.sunset,
+    f.date, f.temperature
+FROM cities c
+LEFT JOIN forecasts f ON f.city_id = c.id
+WHERE c.id = ANY($1::INTEGER[])
+ORDER BY c.id, f.date
+`
+
+type ShortFcastForCitiesRow struct {
+	ID          int32
+	City        sql.NullString
+	Latitude    float64
+	Longitude   float64
+	Country     sql.NullString
+	Timezone    int32
+	Sunrise     int64
+	Sunset      int64
+	Date        sql.NullInt64
+	Temperature sql.NullFloat64
+}
+
+// краткий прогноз сразу по нескольким городам, город без прогноза возвращается одной строкой с пустыми date и temperature
+func (q *Queries) ShortFcastForCities(ctx context.Context, cityIds []int32) ([]ShortFcastForCitiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, shortFcastForCities, pq.Array(cityIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShortFcastForCitiesRow
+	for rows.Next() {
+		var i ShortFcastForCitiesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.City,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Country,
+			&i.Timezone,
+			&i.Sunrise,
+			&i.Sunset,
+			&i.Date,
+			&i.Temperature,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const shortFcastForCity = `-- name: ShortFcastForCity :many
 SELECT f.city_id, f.date, f.temperature
 FROM forecasts f
 WHERE f.city_id = $1
+ORDER BY f.date
 `
 
 type ShortFcastForCityRow struct {
@@ -197,3 +1083,89 @@ func (q *Queries) ShortFcastForCity(ctx context.Context, cityID int32) ([]ShortF
 	}
 	return items, nil
 }
+
+const triggerAlert = `-- name: TriggerAlert :execrows
+INSERT INTO alert_events(rule_id, city_id, forecast_date, value)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (rule_id) WHERE resolved_at IS NULL DO NOTHING
+`
+
+type TriggerAlertParams struct {
+	RuleID       int32
+	CityID       int32
+	ForecastDate int64
+	Value        float64
+}
+
+// открывает событие по правилу, если открытого ещё нет, повторное срабатывание ничего не меняет
+func (q *Queries) TriggerAlert(ctx context.Context, arg TriggerAlertParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, triggerAlert,
+		arg.RuleID,
+		arg.CityID,
+		arg.ForecastDate,
+		arg.Value,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateCityTimezone = `-- name: UpdateCityTimezone :exec
+UPDATE cities
+SET timezone = $2, sunrise = $3, sunset = $4
+WHERE id = $1
+`
+
+type UpdateCityTimezoneParams struct {
+	ID       int32
+	Timezone int32
+	Sunrise  int64
+	Sunset   int64
+}
+
+func (q *Queries) UpdateCityTimezone(ctx context.Context, arg UpdateCityTimezoneParams) error {
+	_, err := q.db.ExecContext(ctx, updateCityTimezone,
+		arg.ID,
+		arg.Timezone,
+		arg.Sunrise,
+		arg.Sunset,
+	)
+	return err
+}
+
+const useAPIKey = `-- name: UseAPIKey :one
+WITH today AS (
+    INSERT INTO api_key_usage(key_id, day, requests)
+    VALUES ($1, $2::DATE, 1)
+    ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+    RETURNING requests
+)
+SELECT t.requests AS daily_requests,
+    (t.requests + COALESCE((
+        SELECT SUM(u.requests)
+        FROM api_key_usage u
+        WHERE u.key_id = $1
+          AND u.day >= date_trunc('month', $2::DATE)::DATE
+          AND u.day < $2::DATE
+    ), 0))::BIGINT AS monthly_requests
+FROM today t
+`
+
+type UseAPIKeyParams struct {
+	KeyID int32
+	Day   time.Time
+}
+
+type UseAPIKeyRow struct {
+	DailyRequests   int64
+	MonthlyRequests int64
+}
+
+// учитывает запрос по ключу за день day и возвращает количество запросов за этот день и за месяц этого дня
+func (q *Queries) UseAPIKey(ctx context.Context, arg UseAPIKeyParams) (UseAPIKeyRow, error) {
+	row := q.db.QueryRowContext(ctx, useAPIKey, arg.KeyID, arg.Day)
+	var i UseAPIKeyRow
+	err := row.Scan(&i.DailyRequests, &i.MonthlyRequests)
+	return i, err
+}
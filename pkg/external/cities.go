@@ -0,0 +1,116 @@
+package openweather
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+)
+
+var (
+	ErrCityNotFound = errors.New("city not found")
+	ErrCityExists   = errors.New("city already exists")
+)
+
+// AddCityByName получает координаты города по названию и добавляет все найденные города
+func (ow *OpenWeatherAPI) AddCityByName(ctx context.Context, name string) ([]repository.City, error) {
+	citiesGeo, err := ow.provider.FetchCitiesGeo(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("нет данных о городе: %w", err)
+	}
+
+	if len(citiesGeo) == 0 {
+		return nil, ErrCityNotFound
+	}
+
+	cities := make([]repository.City, 0, len(citiesGeo))
+	for _, cityitem := range citiesGeo {
+		city, err := ow.AddCity(ctx, cityitem)
+		if err != nil {
+			return cities, err
+		}
+		cities = append(cities, city)
+	}
+
+	return cities, nil
+}
+
+// AddCity сохраняет город в БД и сразу запускает обновление прогноза по нему
+func (ow *OpenWeatherAPI) AddCity(ctx context.Context, cityitem CityGeoData) (repository.City, error) {
+	params := newCityParams(cityitem)
+
+	// при совпадении координат с уже сохранённым городом запрос ничего не возвращает
+	cityID, err := ow.repo.NewCitiesList(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.City{}, ErrCityExists
+	}
+	if err != nil {
+		return repository.City{}, err
+	}
+
+	city := repository.City{
+		ID:        cityID,
+		City:      params.City,
+		Latitude:  params.Latitude,
+		Longitude: params.Longitude,
+		Country:   params.Country,
+	}
+
+	ow.track(city, true)
+
+	return city, nil
+}
+
+// RemoveCity останавливает обновление прогноза по городу и удаляет город вместе с прогнозами.
+// Город удаляется только после завершения горутины обновления, иначе начатое обновление
+// может записать прогноз уже после удаления города
+func (ow *OpenWeatherAPI) RemoveCity(ctx context.Context, cityID int32) error {
+	select {
+	case <-ow.untrack(cityID):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	deleted, err := ow.repo.DeleteCity(ctx, cityID)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrCityNotFound
+	}
+
+	metrics.CityRemoved(cityID)
+	ow.notify(ctx, cityID)
+
+	return nil
+}
+
+// SetCityDisabled выключает или включает обновление прогноза по городу,
+// сохранённый прогноз при этом остаётся доступным
+func (ow *OpenWeatherAPI) SetCityDisabled(ctx context.Context, cityID int32, disabled bool) (repository.City, error) {
+	city, err := ow.repo.SetCityDisabled(ctx, repository.SetCityDisabledParams{
+		ID:       cityID,
+		Disabled: disabled,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return city, ErrCityNotFound
+	}
+	if err != nil {
+		return city, err
+	}
+
+	if disabled {
+		ow.untrack(cityID)
+	} else {
+		ow.track(city, true)
+	}
+
+	// признак disabled отдаётся вместе с прогнозом, по этому подписчики сбрасывают данные по городу
+	ow.notify(ctx, cityID)
+
+	return city, nil
+}
@@ -0,0 +1,135 @@
+package openweather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// шаг прогноза и количество записей такие же как у openweather: 5 дней по 3 часа
+const (
+	fakeForecastStep  = 3 * time.Hour
+	fakeForecastCount = 40
+)
+
+// координаты городов, которые FakeProvider отдаёт без обращения к сети
+var fakeCities = map[string]CityGeoData{
+	"moscow":           {Name: "Moscow", Latitude: 55.7504461, Longitude: 37.6174943, Country: "RU"},
+	"nizhny novgorod":  {Name: "Nizhny Novgorod", Latitude: 56.3264816, Longitude: 44.0051395, Country: "RU"},
+	"saint petersburg": {Name: "Saint Petersburg", Latitude: 59.938732, Longitude: 30.316229, Country: "RU"},
+	"chelyabinsk":      {Name: "Chelyabinsk", Latitude: 55.1598408, Longitude: 61.4025547, Country: "RU"},
+	"izhevsk":          {Name: "Izhevsk", Latitude: 56.8527444, Longitude: 53.2113961, Country: "RU"},
+	"kazan":            {Name: "Kazan", Latitude: 55.7823547, Longitude: 49.1242266, Country: "RU"},
+	"krasnodar":        {Name: "Krasnodar", Latitude: 45.0351532, Longitude: 38.9772396, Country: "RU"},
+	"krasnoyarsk":      {Name: "Krasnoyarsk", Latitude: 56.0090968, Longitude: 92.8725147, Country: "RU"},
+	"novosibirsk":      {Name: "Novosibirsk", Latitude: 55.0282171, Longitude: 82.9234509, Country: "RU"},
+	"omsk":             {Name: "Omsk", Latitude: 54.9848136, Longitude: 73.3674638, Country: "RU"},
+	"perm":             {Name: "Perm", Latitude: 58.0103211, Longitude: 56.2341778, Country: "RU"},
+	"rostov-on-don":    {Name: "Rostov-on-Don", Latitude: 47.2213858, Longitude: 39.7114196, Country: "RU"},
+	"samara":           {Name: "Samara", Latitude: 53.198627, Longitude: 50.113987, Country: "RU"},
+	"saratov":          {Name: "Saratov", Latitude: 51.530376, Longitude: 45.9530257, Country: "RU"},
+	"tolyatti":         {Name: "Tolyatti", Latitude: 53.5205348, Longitude: 49.3894028, Country: "RU"},
+	"tyumen":           {Name: "Tyumen", Latitude: 57.153534, Longitude: 65.542274, Country: "RU"},
+	"ufa":              {Name: "Ufa", Latitude: 54.7261409, Longitude: 55.947499, Country: "RU"},
+	"volgograd":        {Name: "Volgograd", Latitude: 48.7081906, Longitude: 44.5153353, Country: "RU"},
+	"voronezh":         {Name: "Voronezh", Latitude: 51.6605982, Longitude: 39.2005858, Country: "RU"},
+	"yekaterinburg":    {Name: "Yekaterinburg", Latitude: 56.839104, Longitude: 60.60825, Country: "RU"},
+}
+
+// FakeProvider реализация Provider без сети и без ключа API,
+// отдаёт заранее подготовленный ответ openweather (например pkg/model.json)
+type FakeProvider struct {
+	raw ForecastRawData
+	now func() time.Time
+}
+
+// NewFakeProvider разбирает ответ /data/2.5/forecast, который будет отдаваться на любые координаты
+func NewFakeProvider(fixture []byte) (*FakeProvider, error) {
+	var raw ForecastRawData
+
+	err := json.Unmarshal(fixture, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("не разобран файл с прогнозом: %w", err)
+	}
+
+	if len(raw.List) == 0 {
+		return nil, errors.New("в файле нет ни одного прогноза")
+	}
+
+	return &FakeProvider{
+		raw: raw,
+		now: time.Now,
+	}, nil
+}
+
+func NewFakeProviderFromFile(path string) (*FakeProvider, error) {
+	fixture, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не прочитан файл с прогнозом: %w", err)
+	}
+
+	return NewFakeProvider(fixture)
+}
+
+// для известных городов отдаём реальные координаты,
+// для остальных координаты города из файла с прогнозом
+func (p *FakeProvider) FetchCitiesGeo(ctx context.Context, cityName string) ([]CityGeoData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if city, ok := fakeCities[strings.ToLower(strings.TrimSpace(cityName))]; ok {
+		return []CityGeoData{city}, nil
+	}
+
+	return []CityGeoData{{
+		Name:      cityName,
+		Latitude:  p.raw.City.Coord.Lat,
+		Longitude: p.raw.City.Coord.Lon,
+		Country:   p.raw.City.Country,
+	}}, nil
+}
+
+// записи из файла повторяются по кругу, а время сдвигается так,
+// что прогноз начинается со следующего трёхчасового интервала от текущего момента,
+// часовой пояс считается по долготе, восход в 6:00 и закат в 18:00 местного времени
+func (p *FakeProvider) FetchCityForecast(ctx context.Context, latitude, longitude float64) (CityForecast, error) {
+	if err := ctx.Err(); err != nil {
+		return CityForecast{}, err
+	}
+
+	now := p.now().UTC()
+	start := now.Truncate(fakeForecastStep).Add(fakeForecastStep)
+
+	timezone := int(math.Round(longitude/15)) * 3600
+	localMidnight := now.Add(time.Duration(timezone) * time.Second).Truncate(24 * time.Hour).Add(-time.Duration(timezone) * time.Second)
+
+	forecast := CityForecast{
+		Timezone: timezone,
+		Sunrise:  localMidnight.Add(6 * time.Hour).Unix(),
+		Sunset:   localMidnight.Add(18 * time.Hour).Unix(),
+		List:     make([]Forecast, 0, fakeForecastCount),
+	}
+	for i := 0; i < fakeForecastCount; i++ {
+		item := p.raw.List[i%len(p.raw.List)]
+		// копируем слайс, что бы не делить его между вызовами
+		item.Weather = append([]weatherData(nil), item.Weather...)
+
+		date := start.Add(time.Duration(i) * fakeForecastStep)
+		item.Dt = date.Unix()
+		item.DtTxt = date.Format("2006-01-02 15:04:05")
+
+		forecast.List = append(forecast.List, Forecast{
+			Temp:         item.Main.Temp,
+			Date:         item.Dt,
+			ForecastData: item,
+		})
+	}
+
+	return forecast, nil
+}
@@ -9,6 +9,15 @@ type CityGeoData struct {
 	State      string                 `json:"state"`
 }
 
+// CityForecast прогноз по координатам вместе с данными о месте из ответа openweather
+type CityForecast struct {
+	// сдвиг местного времени от UTC в секундах
+	Timezone int
+	Sunrise  int64
+	Sunset   int64
+	List     []Forecast
+}
+
 type Forecast struct {
 	Temp         float64
 	Date         int64
@@ -49,6 +58,9 @@ type ListData struct {
 	Rain       struct {
 		ThreeH float64 `json:"3h"`
 	} `json:"rain,omitempty"`
+	Snow struct {
+		ThreeH float64 `json:"3h"`
+	} `json:"snow,omitempty"`
 	Sys   sysData `json:"sys"`
 	DtTxt string  `json:"dt_txt"`
 }
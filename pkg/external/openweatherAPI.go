@@ -4,269 +4,351 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
-	"strconv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Ser9unin/WeatherForecast/config"
 	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
-	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
 	"go.uber.org/zap"
 )
 
+// RefreshInterval интервал обновления прогноза по каждому городу, частоту запросов к openweather
+// ограничивает HTTP клиент провайдера, а разброс refreshJitter не даёт всем городам обновляться одновременно
 const (
-	APIcities = "http://api.openweathermap.org/geo/1.0/direct?"
-	APIFcast  = "http://api.openweathermap.org/data/2.5/forecast?"
+	RefreshInterval = 900 * time.Second
+	refreshJitter   = 0.1
 )
 
-// openweather API позволяет сделать только 60 запросов в минуту, по этому массив закоментил частично
-var citiesList = []string{
-	"Moscow",
-	"Nizhny Novgorod",
-	"Saint Petersburg",
-	// "Chelyabinsk",
-	// "Izhevsk",
-	// "Kazan",
-	// "Krasnodar",
-	// "Krasnoyarsk",
-	// "Novosibirsk",
-	// "Omsk",
-	// "Perm",
-	// "Rostov-on-Don",
-	// "Samara",
-	// "Saratov",
-	// "Tolyatti",
-	// "Tyumen",
-	// "Ufa",
-	// "Volgograd",
-	// "Voronezh",
-	// "Yekaterinburg",
+// CityUpdateListener получает уведомление после записи прогноза по городу в БД, включения, отключения или удаления города
+type CityUpdateListener interface {
+	CityUpdated(ctx context.Context, cityID int32)
 }
 
+// worker горутина обновления прогноза по городу, done закрывается после её завершения
+type worker struct {
+	cancel context.CancelFunc
+	done   <-chan struct{}
+}
+
+// closedDone для города, по которому обновление не запущено
+var closedDone = func() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
 type OpenWeatherAPI struct {
-	repo   *repository.Queries
-	logger *zap.Logger
+	repo     *repository.Queries
+	provider Provider
+	logger   *zap.Logger
+
+	// города, которыми заполняется пустая БД при первом запуске,
+	// дальше список городов меняется через API
+	seedCities []string
+
+	mu sync.Mutex
+	// контекст работы сервиса, в нём запускаются горутины обновления,
+	// пока ParallelConcurrentUpd не вызван горутины не запускаются
+	runCtx context.Context
+	// по одной горутине обновления на каждый включенный город
+	workers map[int32]worker
+	// время следующего обновления по каждому городу, по нему API считает Cache-Control
+	nextRefresh map[int32]time.Time
+	listeners   []CityUpdateListener
+
+	// завершена ли первичная загрузка OpenWeatherRun, нужно для проверки готовности сервиса
+	initialLoadDone atomic.Bool
 }
 
-func NewOpenWeatherAPI(db *repository.Queries, logger *zap.Logger) OpenWeatherAPI {
-	return OpenWeatherAPI{
-		repo:   db,
-		logger: logger,
+func NewOpenWeatherAPI(db *repository.Queries, provider Provider, seedCities []string, logger *zap.Logger) *OpenWeatherAPI {
+	return &OpenWeatherAPI{
+		repo:        db,
+		provider:    provider,
+		logger:      logger,
+		seedCities:  seedCities,
+		workers:     make(map[int32]worker),
+		nextRefresh: make(map[int32]time.Time),
 	}
 }
 
-// метод делает первичный запрос к openweatherAPI
-// на получение координат городов и прогноза по каждому городу
-// на заполнения БД
-func (ow *OpenWeatherAPI) OpenWeatherRun(ctx context.Context, APIID string) {
-	var dbCityGeo repository.NewCitiesListParams
+// AddListener подписывает на обновления прогноза по городам, например для сброса кэша
+func (ow *OpenWeatherAPI) AddListener(listener CityUpdateListener) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	ow.listeners = append(ow.listeners, listener)
+}
+
+func (ow *OpenWeatherAPI) notify(ctx context.Context, cityID int32) {
+	ow.mu.Lock()
+	listeners := ow.listeners
+	ow.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.CityUpdated(ctx, cityID)
+	}
+}
+
+// метод делает первичный запрос к openweatherAPI:
+// если в БД ещё нет городов, то получаем координаты городов из seedCities,
+// затем загружаем прогноз по каждому включенному городу
+func (ow *OpenWeatherAPI) OpenWeatherRun(ctx context.Context) {
+	// загрузка считается завершённой и при ошибках, свежесть прогноза проверяется отдельно
+	defer ow.initialLoadDone.Store(true)
+
+	count, err := ow.repo.CitiesCount(ctx)
+	if err != nil {
+		ow.logger.Error("не получены данные из БД:", zap.Error(err))
+		return
+	}
+
+	if count == 0 {
+		ow.seed(ctx)
+	}
+
+	citiesListDB, err := ow.repo.EnabledCities(ctx)
+	if err != nil {
+		ow.logger.Error("не получены данные из БД:", zap.Error(err))
+		return
+	}
+
+	for _, item := range citiesListDB {
+		ow.refreshCity(ctx, item)
+	}
+}
 
-	for _, item := range citiesList {
+// заполняем пустую БД городами из seedCities
+func (ow *OpenWeatherAPI) seed(ctx context.Context) {
+	for _, item := range ow.seedCities {
 		// получаем координаты, и данные о стране
-		citiesGeo := ow.FetchCitiesGeo(item, APIID)
+		citiesGeo, err := ow.provider.FetchCitiesGeo(ctx, item)
+		if err != nil {
+			ow.logger.Error("нет данных о городе:", zap.Error(err))
+			continue
+		}
 
 		if len(citiesGeo) == 0 {
-			ow.logger.Fatal("нет ответа с геоданными")
+			ow.logger.Error("нет ответа с геоданными", zap.String("город", item))
+			continue
 		}
 
-		// так же что бы не спамить openweather из-за ограничения по кол-ву запросов в минуту
-		delay := time.Duration(5 * time.Second)
-		<-time.After(delay)
-
 		for _, cityitem := range citiesGeo {
-			dbCityGeo = repository.NewCitiesListParams{
-				City: sql.NullString{
-					String: cityitem.Name,
-					Valid:  true,
-				},
-				Latitude:  cityitem.Latitude,
-				Longitude: cityitem.Longitude,
-				Country: sql.NullString{
-					String: cityitem.Country,
-					Valid:  true,
-				},
-			}
-
-			// загружаем новый город в БД и обратно получаем CitiID
-			citiID, err := ow.repo.NewCitiesList(ctx, dbCityGeo)
+			_, err := ow.repo.NewCitiesList(ctx, newCityParams(cityitem))
 			if err != nil {
-				ow.logger.Info("нет данных от сервера:", zap.Error(err))
-			}
-
-			// получаем прогноз по координатам города
-			forecast := ow.FetchCityForecast(cityitem.Latitude, cityitem.Longitude, APIID)
-
-			for _, fcitem := range forecast {
-				fcitemBytes, err := json.Marshal(fcitem)
-				if err != nil {
-					ow.logger.Fatal("ошибка маршалинга jsonb:", zap.Error(err))
-				}
-
-				cityForForecast := repository.NewForecastParams{
-					CityID:      citiID,
-					Date:        fcitem.Date,
-					Temperature: fcitem.Temp,
-					Weather:     fcitemBytes,
-				}
-
-				err = ow.repo.NewForecast(ctx, cityForForecast)
-				if err != nil {
-					ow.logger.Fatal("прогноз не загружен в БД:", zap.Error(err))
-				}
+				ow.logger.Info("город не загружен в БД:", zap.Error(err))
 			}
 		}
 	}
 }
 
-// параллельное асинхронное обновление данных по прогнозу раз в 3 часа
-func (ow *OpenWeatherAPI) ParallelConcurrentUpd(ctx context.Context, APIID string) {
-	citiesListDB, err := ow.repo.CitiesList(ctx)
+// InitialLoadDone возвращает true после завершения OpenWeatherRun
+func (ow *OpenWeatherAPI) InitialLoadDone() bool {
+	return ow.initialLoadDone.Load()
+}
+
+// параллельное асинхронное обновление данных по прогнозу раз в 15 минут
+func (ow *OpenWeatherAPI) ParallelConcurrentUpd(ctx context.Context) {
+	ow.mu.Lock()
+	ow.runCtx = ctx
+	ow.mu.Unlock()
+
+	citiesListDB, err := ow.repo.EnabledCities(ctx)
 	if err != nil {
 		ow.logger.Info("не получены данные из БД:", zap.Error(err))
 	}
-	// создаём 20 параллельно существующих горутин по одной на каждый город
+	// создаём параллельно существующие горутины по одной на каждый город
 	// для каждой горутины запускаеи тикер по времени и обновление прогноза в БД
 	// обновление параллельное и асинхронное потому что у нас вряд ли будет 20 процессоров
 	// скорее всего планировщик раскидает 20 горутин по разным процессорам и они будут выполняться асинхронно
 	// в соответствии с логикой планировщика go.
 	for _, item := range citiesListDB {
-		item := item
-		ticker := time.NewTicker(900 * time.Second)
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					forecast := ow.FetchCityForecast(item.Latitude, item.Longitude, APIID)
-
-					for _, fcitem := range forecast {
-						fcitemBytes, err := json.Marshal(fcitem)
-						if err != nil {
-							ow.logger.Error("ошибка маршалинга:", zap.Error(err))
-						}
-
-						cityForForecast := repository.NewForecastParams{
-							CityID:      item.ID,
-							Date:        fcitem.Date,
-							Temperature: fcitem.Temp,
-							Weather:     fcitemBytes,
-						}
-
-						err = ow.repo.NewForecast(ctx, cityForForecast)
-						if err != nil {
-							ow.logger.Info("не обновлены данные в БД:", zap.Error(err))
-						}
-					}
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
+		ow.track(item, false)
 	}
 }
 
-// получаем данные по названиям городов
-func (ow *OpenWeatherAPI) FetchCitiesGeo(cityName string, APIID string) []CityGeoData {
+// запускаем горутину обновления прогноза по городу, если она ещё не запущена,
+// immediate - загрузить прогноз сразу, иначе первое обновление в случайный момент интервала,
+// что бы города, загруженные при старте, не обновлялись одновременно
+func (ow *OpenWeatherAPI) track(city repository.City, immediate bool) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
 
-	ow.logger.Info("Запрос данных", zap.String("город", cityName))
+	if ow.runCtx == nil {
+		return
+	}
 
-	client := &http.Client{}
+	if _, ok := ow.workers[city.ID]; ok {
+		return
+	}
 
-	var citiesGeoData []CityGeoData
+	ctx, cancel := context.WithCancel(ow.runCtx)
+	done := make(chan struct{})
+	ow.workers[city.ID] = worker{cancel: cancel, done: done}
 
-	// если использовать Sprinf пробел в query обрабатывается не верно,
-	// по этому сделал так
-	queryParams := url.Values{}
-	queryParams.Add("appid", APIID)
-	queryParams.Add("limit", config.Requestlimit)
-	queryParams.Add("q", cityName)
+	go func() {
+		defer close(done)
 
-	queryString := queryParams.Encode()
-	requestString := APIcities + queryString
+		next := time.Duration(rand.Int63n(int64(RefreshInterval)))
+		if immediate {
+			ow.refreshCity(ctx, city)
+			next = jitter(RefreshInterval)
+		}
+		ow.scheduleRefresh(city.ID, next)
+
+		timer := time.NewTimer(next)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				ow.refreshCity(ctx, city)
+				next = jitter(RefreshInterval)
+				ow.scheduleRefresh(city.ID, next)
+				timer.Reset(next)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
 
-	body, err := middleware.CheckHttpRequest(client, requestString)
-	if err != nil {
-		ow.logger.Error("нет данных о городе:", zap.Error(err))
-		return nil
-	}
+// останавливаем горутину обновления прогноза по городу, возвращаемый канал закрывается,
+// когда горутина завершится, в том числе дождавшись начатого обновления прогноза
+func (ow *OpenWeatherAPI) untrack(cityID int32) <-chan struct{} {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
 
-	err = json.Unmarshal(body, &citiesGeoData)
-	if err != nil {
-		ow.logger.Error("ошибка маршалинга:", zap.Error(err))
-		return nil
+	delete(ow.nextRefresh, cityID)
+
+	w, ok := ow.workers[cityID]
+	if !ok {
+		return closedDone
 	}
+	w.cancel()
+	delete(ow.workers, cityID)
 
-	return citiesGeoData
+	return w.done
 }
 
-// метод позволяет получить прогноз на основе данных о координатах города
-func (ow *OpenWeatherAPI) FetchCityForecast(latitude, longitude float64, APIID string) []Forecast {
-	ow.logger.Info("Запрос по координатам", zap.Float64("Lat", latitude), zap.Float64("Lon", longitude))
+func (ow *OpenWeatherAPI) scheduleRefresh(cityID int32, next time.Duration) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
 
-	var forecast []Forecast
+	// горутина могла быть остановлена, пока обновляла прогноз
+	if _, ok := ow.workers[cityID]; ok {
+		ow.nextRefresh[cityID] = time.Now().Add(next)
+	}
+}
 
-	requestString := fmt.Sprintf("%slat=%f&lon=%f&appid=%s", APIFcast, latitude, longitude, APIID)
-	ow.logger.Info(requestString)
+// NextRefresh время следующего запланированного обновления прогноза по городу,
+// false если обновление города не запущено, например город отключен
+func (ow *OpenWeatherAPI) NextRefresh(cityID int32) (time.Time, bool) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
 
-	client := &http.Client{}
-	body, err := middleware.CheckHttpRequest(client, requestString)
+	next, ok := ow.nextRefresh[cityID]
+	return next, ok
+}
 
+// получаем прогноз по координатам города и сохраняем его в БД
+func (ow *OpenWeatherAPI) refreshCity(ctx context.Context, city repository.City) {
+	forecast, err := ow.provider.FetchCityForecast(ctx, city.Latitude, city.Longitude)
 	if err != nil {
-		ow.logger.Error("ошибка маршалинга ответа:", zap.Error(err))
-		return nil
+		ow.logger.Error("прогноз не получен:", zap.Error(err))
+		metrics.CityRefreshFailed("fetch")
+		return
 	}
 
-	forecast, err = parseRawData(body)
+	rows, err := ow.storeForecast(ctx, city.ID, time.Now().Unix(), forecast.List)
+	metrics.ForecastRowsUpserted(rows)
 	if err != nil {
-		ow.logger.Error("ошибка парсинга прогноза:", zap.Error(err))
-		return forecast
+		ow.logger.Info("не обновлены данные в БД:", zap.Error(err))
+		metrics.CityRefreshFailed("store")
+	} else {
+		metrics.CityRefreshed(city.ID, time.Now())
 	}
 
-	return forecast
-}
-
-// парсим ответ от сервера openweather
-func parseRawData(body []byte) ([]Forecast, error) {
-	var forecastRawData ForecastRawData
-
-	// не ожидаю получения более 40 прогнозов по времени
-	// т.к. сервер отдает прогноз на 5 дней с интервалом 3 часа.
-	forecast := make([]Forecast, 0, 40)
-
-	err := json.Unmarshal(body, &forecastRawData)
+	// часовой пояс нужен API для границ дней и разбора запрошенного времени
+	err = ow.repo.UpdateCityTimezone(ctx, repository.UpdateCityTimezoneParams{
+		ID:       city.ID,
+		Timezone: int32(forecast.Timezone),
+		Sunrise:  forecast.Sunrise,
+		Sunset:   forecast.Sunset,
+	})
 	if err != nil {
-		return nil, err
+		ow.logger.Info("не обновлен часовой пояс города:", zap.Error(err))
 	}
 
-	codeFromServer := forecastRawData.Cod.(string)
-	statCode, err := strconv.Atoi(codeFromServer)
-	if err != nil {
-		return nil, err
+	if rows > 0 {
+		err = ow.repo.SetCityForecastUpdated(ctx, city.ID)
+		if err != nil {
+			ow.logger.Info("не обновлено время записи прогноза:", zap.Error(err))
+		}
 	}
 
-	if statCode != 200 {
-		return nil, errors.New(forecastRawData.Message.(string))
-	}
+	// даже при частичной записи часть прогноза в БД уже новая
+	ow.notify(ctx, city.ID)
+}
 
-	// по заданию требование хранить в БД данные о времени, средней температуре и полный прогноз на указанное время,
-	// а сервер возвращает прогноз в виде одной структуры с 40 записями на разное время
-	for _, item := range forecastRawData.List {
+// сохраняем прогноз по городу в БД, каждая запись прогноза хранится целиком в jsonb,
+// в forecasts остаётся последний прогноз, а в forecast_revisions история с временем выпуска issuedAt,
+// возвращается количество записей, записанных в forecasts
+func (ow *OpenWeatherAPI) storeForecast(ctx context.Context, cityID int32, issuedAt int64, forecast []Forecast) (int, error) {
+	var rows int
+	for _, fcitem := range forecast {
+		fcitemBytes, err := json.Marshal(fcitem)
+		if err != nil {
+			return rows, fmt.Errorf("ошибка маршалинга jsonb: %w", err)
+		}
 
-		forecastItem := Forecast{
-			Temp:         item.Main.Temp,
-			Date:         item.Dt,
-			ForecastData: item,
+		cityForForecast := repository.NewForecastParams{
+			CityID:      cityID,
+			Date:        fcitem.Date,
+			Temperature: fcitem.Temp,
+			Weather:     fcitemBytes,
 		}
 
-		// проверяю что количество данных полученных в прогнозе не превышает 40 элементов
-		// иначе мы выходим за границы слайса
-		if len(forecast) == cap(forecast) {
-			return forecast, errors.New("объём полученных данных превысил лимит")
+		err = ow.repo.NewForecast(ctx, cityForForecast)
+		if err != nil {
+			return rows, err
+		}
+		rows++
+
+		err = ow.repo.NewForecastRevision(ctx, repository.NewForecastRevisionParams{
+			CityID:      cityID,
+			IssuedAt:    issuedAt,
+			Date:        fcitem.Date,
+			Temperature: fcitem.Temp,
+			Weather:     fcitemBytes,
+		})
+		if err != nil {
+			return rows, err
 		}
-		forecast = append(forecast, forecastItem)
 	}
 
-	return forecast, nil
+	return rows, nil
+}
+
+// случайное отклонение интервала на ±refreshJitter
+func jitter(d time.Duration) time.Duration {
+	delta := (rand.Float64()*2 - 1) * refreshJitter * float64(d)
+	return d + time.Duration(delta)
+}
+
+func newCityParams(cityitem CityGeoData) repository.NewCitiesListParams {
+	return repository.NewCitiesListParams{
+		City: sql.NullString{
+			String: cityitem.Name,
+			Valid:  cityitem.Name != "",
+		},
+		Latitude:  cityitem.Latitude,
+		Longitude: cityitem.Longitude,
+		Country: sql.NullString{
+			String: cityitem.Country,
+			Valid:  cityitem.Country != "",
+		},
+	}
 }
@@ -0,0 +1,147 @@
+package openweather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Ser9unin/WeatherForecast/config"
+	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+	"go.uber.org/zap"
+)
+
+// адрес сервиса можно заменить, например на cmd/owstub для работы без сети,
+// пути к методам API остаются такими же как у openweathermap.org
+const (
+	DefaultBaseURL = "https://api.openweathermap.org"
+	APIcities      = "/geo/1.0/direct"
+	APIFcast       = "/data/2.5/forecast"
+)
+
+// OpenWeatherProvider реализация Provider поверх API openweathermap.org
+type OpenWeatherProvider struct {
+	baseURL string
+	apiID   string
+	client  *middleware.Client
+	logger  *zap.Logger
+}
+
+func NewOpenWeatherProvider(baseURL, APIID string, client *middleware.Client, logger *zap.Logger) *OpenWeatherProvider {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &OpenWeatherProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiID:   APIID,
+		client:  client,
+		logger:  logger,
+	}
+}
+
+// получаем данные по названиям городов
+func (p *OpenWeatherProvider) FetchCitiesGeo(ctx context.Context, cityName string) ([]CityGeoData, error) {
+	p.logger.Info("Запрос данных", zap.String("город", cityName))
+
+	var citiesGeoData []CityGeoData
+
+	// если использовать Sprinf пробел в query обрабатывается не верно,
+	// по этому сделал так
+	queryParams := url.Values{}
+	queryParams.Add("appid", p.apiID)
+	queryParams.Add("limit", config.Requestlimit)
+	queryParams.Add("q", cityName)
+
+	requestString := p.baseURL + APIcities + "?" + queryParams.Encode()
+
+	body, err := p.client.Get(ctx, requestString)
+	if err != nil {
+		return nil, fmt.Errorf("нет данных о городе: %w", err)
+	}
+
+	err = json.Unmarshal(body, &citiesGeoData)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка маршалинга: %w", err)
+	}
+
+	return citiesGeoData, nil
+}
+
+// метод позволяет получить прогноз на основе данных о координатах города
+func (p *OpenWeatherProvider) FetchCityForecast(ctx context.Context, latitude, longitude float64) (CityForecast, error) {
+	p.logger.Info("Запрос по координатам", zap.Float64("Lat", latitude), zap.Float64("Lon", longitude))
+
+	queryParams := url.Values{}
+	queryParams.Add("lat", strconv.FormatFloat(latitude, 'f', -1, 64))
+	queryParams.Add("lon", strconv.FormatFloat(longitude, 'f', -1, 64))
+	queryParams.Add("appid", p.apiID)
+
+	requestString := p.baseURL + APIFcast + "?" + queryParams.Encode()
+
+	body, err := p.client.Get(ctx, requestString)
+	if err != nil {
+		return CityForecast{}, fmt.Errorf("нет ответа с прогнозом: %w", err)
+	}
+
+	forecast, err := parseRawData(body)
+	if err != nil {
+		return forecast, fmt.Errorf("ошибка парсинга прогноза: %w", err)
+	}
+
+	return forecast, nil
+}
+
+// парсим ответ от сервера openweather
+func parseRawData(body []byte) (CityForecast, error) {
+	var forecastRawData ForecastRawData
+
+	// не ожидаю получения более 40 прогнозов по времени
+	// т.к. сервер отдает прогноз на 5 дней с интервалом 3 часа.
+	forecast := CityForecast{
+		List: make([]Forecast, 0, 40),
+	}
+
+	err := json.Unmarshal(body, &forecastRawData)
+	if err != nil {
+		return forecast, err
+	}
+
+	// в успешном ответе cod строка "200", а в ответах с ошибкой бывает и число, например 401
+	codeFromServer := fmt.Sprint(forecastRawData.Cod)
+	statCode, err := strconv.Atoi(codeFromServer)
+	if err != nil {
+		return forecast, err
+	}
+
+	if statCode != 200 {
+		return forecast, fmt.Errorf("openweather ответил %d: %v", statCode, forecastRawData.Message)
+	}
+
+	forecast.Timezone = forecastRawData.City.Timezone
+	forecast.Sunrise = int64(forecastRawData.City.Sunrise)
+	forecast.Sunset = int64(forecastRawData.City.Sunset)
+
+	// по заданию требование хранить в БД данные о времени, средней температуре и полный прогноз на указанное время,
+	// а сервер возвращает прогноз в виде одной структуры с 40 записями на разное время
+	for _, item := range forecastRawData.List {
+
+		forecastItem := Forecast{
+			Temp:         item.Main.Temp,
+			Date:         item.Dt,
+			ForecastData: item,
+		}
+
+		// проверяю что количество данных полученных в прогнозе не превышает 40 элементов
+		// иначе мы выходим за границы слайса
+		if len(forecast.List) == cap(forecast.List) {
+			return forecast, errors.New("объём полученных данных превысил лимит")
+		}
+		forecast.List = append(forecast.List, forecastItem)
+	}
+
+	return forecast, nil
+}
@@ -0,0 +1,21 @@
+package openweather
+
+import "context"
+
+// Geocoder позволяет получить координаты и страну города по его названию
+type Geocoder interface {
+	FetchCitiesGeo(ctx context.Context, cityName string) ([]CityGeoData, error)
+}
+
+// ForecastProvider позволяет получить прогноз на 5 дней с шагом 3 часа по координатам,
+// вместе с прогнозом возвращается часовой пояс места и время восхода и заката
+type ForecastProvider interface {
+	FetchCityForecast(ctx context.Context, latitude, longitude float64) (CityForecast, error)
+}
+
+// Provider внешний источник данных о погоде, от которого зависит загрузка прогнозов в БД,
+// реализации: OpenWeatherProvider для openweathermap.org и FakeProvider с заранее подготовленными данными
+type Provider interface {
+	Geocoder
+	ForecastProvider
+}
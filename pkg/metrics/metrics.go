@@ -0,0 +1,194 @@
+// Package metrics содержит метрики сервиса в формате Prometheus, отдаются на /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "weather"
+
+// Registry отдельный реестр, что бы в /metrics попадали только метрики сервиса, процесса и Go
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Количество запросов к API по маршруту, методу и коду ответа.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Время обработки запросов к API по маршруту, методу и коду ответа.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	providerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Количество запросов к внешнему источнику по методу и результату: ok, client_error, server_error, error, rejected.",
+	}, []string{"client", "endpoint", "result"})
+
+	providerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Время одной попытки запроса к внешнему источнику.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"client", "endpoint"})
+
+	providerRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_retries_total",
+		Help:      "Количество повторов запросов к внешнему источнику.",
+	}, []string{"client", "endpoint"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_breaker_state",
+		Help:      "Состояние circuit breaker: 0 closed, 1 open, 2 half-open.",
+	}, []string{"client"})
+
+	cityLastRefresh = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "city_last_refresh_timestamp_seconds",
+		Help:      "Время последней успешной загрузки прогноза по городу.",
+	}, []string{"city_id"})
+
+	cityRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "city_refresh_failures_total",
+		Help:      "Количество неудачных загрузок прогноза по этапу: fetch или store.",
+	}, []string{"stage"})
+
+	forecastRowsUpserted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forecast_rows_upserted_total",
+		Help:      "Количество записей прогноза, записанных в БД запросом NewForecast.",
+	})
+
+	alertEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_events_total",
+		Help:      "Количество сработавших и снятых оповещений по прогнозу: triggered или resolved.",
+	}, []string{"state"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		httpRequests,
+		httpDuration,
+		providerRequests,
+		providerDuration,
+		providerRetries,
+		breakerState,
+		cityLastRefresh,
+		cityRefreshFailures,
+		forecastRowsUpserted,
+		alertEvents,
+	)
+}
+
+// Handler отдаёт метрики из Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB добавляет статистику пула соединений из sql.DB.Stats()
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterCache добавляет счётчики попаданий и промахов и размер кэша name,
+// stats вызывается при каждом запросе /metrics
+func RegisterCache(name string, stats func() (hits, misses uint64, entries int)) {
+	labels := prometheus.Labels{"cache": name}
+
+	Registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_hits_total",
+			Help:        "Количество попаданий в кэш.",
+			ConstLabels: labels,
+		}, func() float64 {
+			hits, _, _ := stats()
+			return float64(hits)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_misses_total",
+			Help:        "Количество промахов кэша.",
+			ConstLabels: labels,
+		}, func() float64 {
+			_, misses, _ := stats()
+			return float64(misses)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "cache_entries",
+			Help:        "Количество записей в кэше.",
+			ConstLabels: labels,
+		}, func() float64 {
+			_, _, entries := stats()
+			return float64(entries)
+		}),
+	)
+}
+
+// ObserveHTTP учитывает обработанный запрос к API
+func ObserveHTTP(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObserveProvider учитывает попытку запроса к внешнему источнику
+func ObserveProvider(client, endpoint, result string, duration time.Duration) {
+	providerRequests.WithLabelValues(client, endpoint, result).Inc()
+	providerDuration.WithLabelValues(client, endpoint).Observe(duration.Seconds())
+}
+
+// ProviderRejected учитывает запрос, не отправленный из-за открытого circuit breaker
+func ProviderRejected(client, endpoint string) {
+	providerRequests.WithLabelValues(client, endpoint, "rejected").Inc()
+}
+
+func ProviderRetry(client, endpoint string) {
+	providerRetries.WithLabelValues(client, endpoint).Inc()
+}
+
+func SetBreakerState(client string, state int) {
+	breakerState.WithLabelValues(client).Set(float64(state))
+}
+
+// CityRefreshed отмечает успешную загрузку прогноза по городу
+func CityRefreshed(cityID int32, at time.Time) {
+	cityLastRefresh.WithLabelValues(strconv.Itoa(int(cityID))).Set(float64(at.Unix()))
+}
+
+func CityRefreshFailed(stage string) {
+	cityRefreshFailures.WithLabelValues(stage).Inc()
+}
+
+func ForecastRowsUpserted(rows int) {
+	forecastRowsUpserted.Add(float64(rows))
+}
+
+// AlertEvent учитывает открытое или снятое событие оповещения
+func AlertEvent(state string) {
+	alertEvents.WithLabelValues(state).Inc()
+}
+
+// CityRemoved убирает метрики удалённого города
+func CityRemoved(cityID int32) {
+	cityLastRefresh.DeleteLabelValues(strconv.Itoa(int(cityID)))
+}
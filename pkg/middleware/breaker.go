@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+type BreakerState int
+
+const (
+	// запросы проходят
+	BreakerClosed BreakerState = iota
+	// запросы не отправляются до окончания паузы
+	BreakerOpen
+	// после паузы пропускается один пробный запрос
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	mu       sync.Mutex
+	current  BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration, logger *zap.Logger) *breaker {
+	metrics.SetBreakerState(name, int(BreakerClosed))
+
+	return &breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+	}
+}
+
+// allow решает, можно ли отправить запрос
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.current {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		// пока пробный запрос не завершился остальные не пропускаем
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.current != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.current == BreakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		if b.current != BreakerOpen {
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+// release снимает пробный запрос, который ничего не говорит о состоянии сервиса: отменён вызывающим
+// или получил 429, состояние не меняется и следующий запрос снова будет пробным
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) state() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current
+}
+
+func (b *breaker) setState(state BreakerState) {
+	b.logger.Warn("circuit breaker сменил состояние",
+		zap.String("client", b.name),
+		zap.String("from", b.current.String()),
+		zap.String("to", state.String()),
+		zap.Int("failures", b.failures))
+	b.current = state
+	metrics.SetBreakerState(b.name, int(state))
+}
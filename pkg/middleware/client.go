@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
+	"go.uber.org/zap"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// StatusError ответ внешнего сервиса с кодом не 2xx
+type StatusError struct {
+	StatusCode int
+	// значение заголовка Retry-After, 0 если его нет
+	RetryAfter time.Duration
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("сервис ответил %d: %s", e.StatusCode, e.Body)
+}
+
+// ClientCfg настройки устойчивого HTTP клиента
+type ClientCfg struct {
+	// таймаут одной попытки
+	Timeout time.Duration
+	// количество повторов после первой попытки
+	MaxRetries int
+	// начальная и максимальная пауза между повторами, пауза растёт вдвое с каждой попыткой
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// если Retry-After больше этого значения, запрос не повторяется
+	MaxRetryAfter time.Duration
+	// после стольких неудач подряд запросы не отправляются BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// ограничитель частоты, токен берётся на каждую попытку, включая повторы, nil без ограничения
+	Limiter *ratelimit.Limiter
+}
+
+// Client HTTP клиент для запросов к внешним сервисам:
+// таймаут на попытку, повторы с экспоненциальной паузой при 5xx и сетевых ошибках,
+// ожидание Retry-After при 429, circuit breaker, пока сервис недоступен, и ограничение частоты попыток
+type Client struct {
+	name    string
+	client  *http.Client
+	cfg     ClientCfg
+	breaker *breaker
+	logger  *zap.Logger
+}
+
+func NewClient(name string, cfg ClientCfg, logger *zap.Logger) *Client {
+	return &Client{
+		name:    name,
+		client:  &http.Client{},
+		cfg:     cfg,
+		breaker: newBreaker(name, cfg.BreakerThreshold, cfg.BreakerCooldown, logger),
+		logger:  logger,
+	}
+}
+
+// Get выполняет GET запрос с повторами и возвращает тело ответа
+func (c *Client) Get(ctx context.Context, request string) ([]byte, error) {
+	var lastErr error
+	endpoint := endpointPath(request)
+
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff(attempt, lastErr)
+			c.logger.Warn("повтор запроса",
+				zap.String("url", redact(request)),
+				zap.Int("attempt", attempt),
+				zap.Duration("wait", wait),
+				zap.Error(lastErr))
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+			metrics.ProviderRetry(c.name, endpoint)
+		}
+
+		// токен берётся до проверки breaker, что бы пробный запрос не ждал очереди в ограничителе
+		if c.cfg.Limiter != nil {
+			err := c.cfg.Limiter.Wait(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !c.breaker.allow() {
+			metrics.ProviderRejected(c.name, endpoint)
+			return nil, ErrCircuitOpen
+		}
+
+		start := time.Now()
+		body, err := c.do(ctx, request)
+		metrics.ObserveProvider(c.name, endpoint, result(err), time.Since(start))
+		if err == nil {
+			c.breaker.success()
+			return body, nil
+		}
+
+		lastErr = err
+		if ctx.Err() != nil {
+			// запрос отменён вызывающим, о состоянии сервиса это ничего не говорит,
+			// но пробный запрос нужно снять, иначе breaker останется в half-open навсегда
+			c.breaker.release()
+			return nil, err
+		}
+
+		var statusErr *StatusError
+		isStatus := errors.As(err, &statusErr)
+		switch {
+		case isStatus && statusErr.StatusCode == http.StatusTooManyRequests:
+			// 429 значит что сервис работает, но просит подождать, это не неудача для breaker,
+			// запрос повторяется после Retry-After
+			c.breaker.release()
+		case !retryable(err):
+			// ответ 4xx значит что сервис работает, ошибка в самом запросе
+			c.breaker.success()
+			return body, err
+		default:
+			c.breaker.failure()
+		}
+
+		if isStatus && statusErr.RetryAfter > c.cfg.MaxRetryAfter {
+			return body, err
+		}
+	}
+
+	return nil, fmt.Errorf("запрос не выполнен после %d попыток: %w", c.cfg.MaxRetries+1, lastErr)
+}
+
+// одна попытка со своим таймаутом
+func (c *Client) do(ctx context.Context, request string) ([]byte, error) {
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	return CheckHttpRequest(ctx, c.client, request)
+}
+
+// пауза перед повтором: Retry-After при 429, иначе экспоненциальная пауза с полным случайным разбросом
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+
+	backoff := c.cfg.BaseBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > c.cfg.MaxBackoff {
+		backoff = c.cfg.MaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// повторяем сетевые ошибки, 5xx и 429
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	return true
+}
+
+// результат попытки для метрик
+func result(err error) string {
+	var statusErr *StatusError
+
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return "server_error"
+	case errors.As(err, &statusErr):
+		return "client_error"
+	default:
+		return "error"
+	}
+}
+
+// Retry-After бывает в секундах или в виде даты
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// в логи не попадает ключ API из query
+func redact(request string) string {
+	u, err := url.Parse(request)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// путь запроса без параметров, метка endpoint в метриках
+func endpointPath(request string) string {
+	u, err := url.Parse(request)
+	if err != nil {
+		return ""
+	}
+
+	return u.Path
+}
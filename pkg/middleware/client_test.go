@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestClientReleasesProbeOnCancel(t *testing.T) {
+	var fail, block atomic.Bool
+	fail.Store(true)
+	started := make(chan struct{}, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block.Load() {
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	cooldown := 20 * time.Millisecond
+	client := NewClient("test-probe", ClientCfg{
+		Timeout:          time.Second,
+		BreakerThreshold: 1,
+		BreakerCooldown:  cooldown,
+	}, zap.NewNop())
+
+	// одна ошибка открывает breaker
+	_, err := client.Get(context.Background(), srv.URL)
+	if err == nil {
+		t.Fatal("expected error from failing server")
+	}
+	if state := client.breaker.state(); state != BreakerOpen {
+		t.Fatalf("breaker state = %s, want open", state)
+	}
+
+	// после паузы пробный запрос отменяется, пока сервис не ответил
+	time.Sleep(cooldown)
+	block.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err = client.Get(ctx, srv.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("probe error = %v, want context.Canceled", err)
+	}
+	if state := client.breaker.state(); state != BreakerHalfOpen {
+		t.Fatalf("breaker state after cancelled probe = %s, want half-open", state)
+	}
+
+	// следующий запрос снова пробный и закрывает breaker
+	block.Store(false)
+	fail.Store(false)
+
+	body, err := client.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("request after cancelled probe: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Fatalf("body = %q, want ok", body)
+	}
+	if state := client.breaker.state(); state != BreakerClosed {
+		t.Fatalf("breaker state = %s, want closed", state)
+	}
+}
+
+func TestClientLimiterCoversRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	// 2 токена на час, третья попытка ждёт токен дольше таймаута запроса
+	client := NewClient("test-limiter", ClientCfg{
+		Timeout:     time.Second,
+		MaxRetries:  3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Limiter:     ratelimit.NewLimiter(ratelimit.Rate{Limit: 2, Per: time.Hour}),
+	}, zap.NewNop())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := client.Get(ctx, srv.URL)
+	if err == nil {
+		t.Fatal("expected error from failing server")
+	}
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("server got %d requests, want 2", n)
+	}
+}
+
+// 429 не открывает breaker: запрос повторяется после Retry-After
+func TestClientTooManyRequestsKeepsBreakerClosed(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := NewClient("test-429", ClientCfg{
+		Timeout:          time.Second,
+		MaxRetries:       1,
+		MaxBackoff:       time.Millisecond,
+		MaxRetryAfter:    time.Minute,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	}, zap.NewNop())
+
+	start := time.Now()
+	body, err := client.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("request after 429: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Fatalf("body = %q, want ok", body)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, want Retry-After 1s", elapsed)
+	}
+	if state := client.breaker.state(); state != BreakerClosed {
+		t.Fatalf("breaker state = %s, want closed", state)
+	}
+}
@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -31,6 +33,16 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush нужен для ответов, которые отправляются клиенту по частям
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// APIKeyParam параметр запроса, в котором можно передать ключ API, в лог он не пишется
+const APIKeyParam = "api_key"
+
 func Logger(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -43,7 +55,7 @@ func Logger(next http.HandlerFunc) http.HandlerFunc {
 			zap.Int("response_size", sw.size),
 			zap.String("latency", time.Since(start).String()),
 			zap.String("method", r.Method),
-			zap.String("uri", r.RequestURI),
+			zap.String("uri", loggedURI(r)),
 			zap.String("host", r.Host),
 			zap.String("remote_ip", r.RemoteAddr),
 		}
@@ -62,8 +74,41 @@ func Logger(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func CheckHttpRequest(client *http.Client, request string) ([]byte, error) {
-	req, err := http.NewRequest("GET", request, nil)
+// loggedURI путь и параметры запроса без ключа API
+func loggedURI(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del(APIKeyParam)
+	if len(query) == 0 {
+		return r.URL.Path
+	}
+
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// Metrics учитывает запросы к API в метриках, маршрут берётся из шаблона, по которому mux выбрал обработчик,
+// что бы /cities/1 и /cities/2 попадали в одну метку /cities/
+func Metrics(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := statusWriter{ResponseWriter: w}
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		mux.ServeHTTP(&sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.ObserveHTTP(route, r.Method, status, time.Since(start))
+	})
+}
+
+func CheckHttpRequest(ctx context.Context, client *http.Client, request string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", request, nil)
 	if err != nil {
 		err = fmt.Errorf("запрос не сформирован: %w", err)
 		return nil, err
@@ -81,5 +126,14 @@ func CheckHttpRequest(client *http.Client, request string) ([]byte, error) {
 		err = fmt.Errorf("не прочитано тело запроса: %w", err)
 		return nil, err
 	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Body:       body,
+		}
+	}
+
 	return body, nil
 }
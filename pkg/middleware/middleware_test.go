@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggedURI(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/cities", "/cities"},
+		{"/cities?api_key=wf_secret", "/cities"},
+		{"/get_full_forecast?city_id=1&api_key=wf_secret&date=2024-01-02", "/get_full_forecast?city_id=1&date=2024-01-02"},
+		{"/alerts?api_key=wf_a&api_key=wf_b&active=true", "/alerts?active=true"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if got := loggedURI(r); got != tt.want {
+			t.Errorf("loggedURI(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
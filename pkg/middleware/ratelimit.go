@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
+)
+
+// RateLimit ограничивает частоту запросов каждого клиента, клиента определяет key,
+// при превышении ответ 429 с Retry-After, заголовки X-RateLimit-* отдаются в каждом ответе,
+// при limiter nil запросы не ограничиваются
+func RateLimit(limiter *ratelimit.KeyedLimiter, key func(r *http.Request) string) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if limiter == nil {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			res := limiter.Allow(key(r))
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error":   "rate limit exceeded",
+					"details": "retry after " + w.Header().Get("Retry-After") + " seconds",
+				})
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP адрес клиента, заголовкам X-Forwarded-For и X-Real-IP верим только если запрос пришёл от доверенного прокси,
+// в X-Forwarded-For берём первый справа адрес, который не является доверенным прокси. Левее некорректного адреса
+// (например unknown, если прокси не нашёл адрес) заголовку верить нельзя, тогда клиентом считается прокси,
+// который его записал. Если все адреса доверенные - самый левый, это ближайший к клиенту прокси
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		// адрес, с которого пришёл текущий адрес списка, для самого правого это адрес соединения
+		writer := host
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				return writer
+			}
+			if !isTrusted(hop, trusted) {
+				return hop
+			}
+			writer = hop
+		}
+		return writer
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return host
+}
+
+func isTrusted(host string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"untrusted remote ignores headers", "203.0.113.5:1234", "198.51.100.1", "", "203.0.113.5"},
+		{"right-most untrusted hop", "10.0.0.1:1234", "198.51.100.1, 203.0.113.7, 10.0.0.2", "", "203.0.113.7"},
+		{"invalid hop stops at the proxy that wrote it", "10.0.0.1:1234", "198.51.100.1, unknown, 10.0.0.2", "", "10.0.0.2"},
+		{"right-most invalid hop falls back to remote", "10.0.0.1:1234", "198.51.100.1, unknown", "198.51.100.9", "10.0.0.1"},
+		{"all hops trusted", "10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"X-Real-IP without X-Forwarded-For", "10.0.0.1:1234", "", "198.51.100.9", "198.51.100.9"},
+		{"no headers", "10.0.0.1:1234", "", "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := ClientIP(r, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
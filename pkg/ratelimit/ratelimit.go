@@ -0,0 +1,209 @@
+// Package ratelimit содержит ограничитель запросов на основе token bucket
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate не больше Limit запросов за период Per
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+// корзина с токенами, пополняется равномерно со скоростью Limit/Per
+type bucket struct {
+	capacity float64
+	tokens   float64
+	perToken time.Duration
+	last     time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = math.Min(b.capacity, b.tokens+float64(elapsed)/float64(b.perToken))
+	b.last = now
+}
+
+// сколько ждать до появления целого токена
+func (b *bucket) delay(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) * float64(b.perToken))
+}
+
+// Limiter пропускает запрос только если токен есть во всех корзинах,
+// например 60 запросов в минуту и 1000 в сутки одновременно
+type Limiter struct {
+	mu      sync.Mutex
+	buckets []*bucket
+	now     func() time.Time
+}
+
+// NewLimiter создаёт ограничитель, правила с Limit <= 0 пропускаются
+func NewLimiter(rates ...Rate) *Limiter {
+	l := &Limiter{now: time.Now}
+
+	start := l.now()
+	for _, rate := range rates {
+		if rate.Limit <= 0 || rate.Per <= 0 {
+			continue
+		}
+
+		l.buckets = append(l.buckets, &bucket{
+			capacity: float64(rate.Limit),
+			tokens:   float64(rate.Limit),
+			perToken: rate.Per / time.Duration(rate.Limit),
+			last:     start,
+		})
+	}
+
+	return l
+}
+
+// Allow забирает токен, если он есть, иначе возвращает через сколько можно повторить запрос
+func (l *Limiter) Allow() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait := l.delay(l.now())
+	if wait > 0 {
+		return false, wait
+	}
+
+	l.take()
+	return true, 0
+}
+
+// Wait ждёт появления токена во всех корзинах и забирает его
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		ok, wait := l.Allow()
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *Limiter) delay(now time.Time) time.Duration {
+	var wait time.Duration
+	for _, b := range l.buckets {
+		wait = max(wait, b.delay(now))
+	}
+
+	return wait
+}
+
+func (l *Limiter) take() {
+	for _, b := range l.buckets {
+		b.tokens--
+	}
+}
+
+// сколько ждать, пока корзина снова заполнится
+func (b *bucket) fullIn(now time.Time) time.Duration {
+	b.refill(now)
+	return time.Duration((b.capacity - b.tokens) * float64(b.perToken))
+}
+
+// Result решение KeyedLimiter по одному запросу
+type Result struct {
+	Allowed bool
+	Limit   int
+	// запросов, которые можно сделать прямо сейчас
+	Remaining int
+	// через сколько можно повторить отклонённый запрос
+	RetryAfter time.Duration
+	// через сколько лимит восстановится полностью
+	Reset time.Duration
+}
+
+// KeyedLimiter отдельная корзина на каждый ключ, например на клиента,
+// корзины, которые заполнились и не использовались, удаляются
+type KeyedLimiter struct {
+	rate Rate
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewKeyedLimiter создаёт ограничитель по ключам, при Limit <= 0 возвращает nil
+func NewKeyedLimiter(rate Rate) *KeyedLimiter {
+	if rate.Limit <= 0 || rate.Per <= 0 {
+		return nil
+	}
+
+	l := &KeyedLimiter{
+		rate:    rate,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	l.lastSweep = l.now()
+
+	return l
+}
+
+// Allow забирает токен из корзины ключа, если он есть
+func (l *KeyedLimiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			capacity: float64(l.rate.Limit),
+			tokens:   float64(l.rate.Limit),
+			perToken: l.rate.Per / time.Duration(l.rate.Limit),
+			last:     now,
+		}
+		l.buckets[key] = b
+	}
+
+	res := Result{Limit: l.rate.Limit}
+	res.RetryAfter = b.delay(now)
+	if res.RetryAfter == 0 {
+		b.tokens--
+		res.Allowed = true
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = b.fullIn(now)
+
+	return res
+}
+
+// раз в период лимита удаляем заполненные корзины, для них результат такой же как для новых
+func (l *KeyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Per {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.fullIn(now) == 0 {
+			delete(l.buckets, key)
+		}
+	}
+}
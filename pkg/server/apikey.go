@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/config"
+	"github.com/Ser9unin/WeatherForecast/pkg/api"
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	"go.uber.org/zap"
+)
+
+const apiKeyUsage = `usage: main apikey <command>
+
+commands:
+  create -name NAME [-admin] [-daily N] [-monthly N]   создать ключ, ключ выводится один раз
+  list                                                 список ключей
+  revoke ID                                            отозвать ключ`
+
+// APIKey выполняет подкоманду apikey: create, list или revoke
+func APIKey(args []string) {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	if len(args) == 0 {
+		fmt.Println(apiKeyUsage)
+		os.Exit(2)
+	}
+
+	cfgDB := config.NewDBConnectionCfg()
+	db, err := openDB(cfgDB)
+	if err != nil {
+		logger.Fatal("unable to start db: ", zap.Error(err))
+	}
+	defer db.Close()
+
+	repo := repository.New(db)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("create", flag.ExitOnError)
+		name := flags.String("name", "", "название ключа, например имя клиента")
+		admin := flags.Bool("admin", false, "ключ администратора, открывает /admin/keys")
+		daily := flags.Int("daily", 0, "запросов в сутки, 0 без ограничения")
+		monthly := flags.Int("monthly", 0, "запросов в месяц, 0 без ограничения")
+		flags.Parse(args[1:])
+
+		value, key, err := api.CreateAPIKey(ctx, repo, api.NewAPIKeyParams{
+			Name:         *name,
+			IsAdmin:      *admin,
+			DailyQuota:   int32(*daily),
+			MonthlyQuota: int32(*monthly),
+		})
+		if err != nil {
+			logger.Fatal("unable to create api key: ", zap.Error(err))
+		}
+		fmt.Printf("created key %d %q\n%s\n", key.ID, key.Name, value)
+	case "list":
+		keys, err := repo.ListAPIKeys(ctx, api.UsageDay(time.Now()))
+		if err != nil {
+			logger.Fatal("unable to list api keys: ", zap.Error(err))
+		}
+
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt.Valid {
+				status = "revoked " + key.RevokedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-20s %s  admin=%t  day %d/%d  month %d/%d  %s\n",
+				key.ID, key.Name, key.Prefix, key.IsAdmin,
+				key.DailyRequests, key.DailyQuota, key.MonthlyRequests, key.MonthlyQuota, status)
+		}
+	case "revoke":
+		if len(args) < 2 {
+			fmt.Println(apiKeyUsage)
+			os.Exit(2)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Println(apiKeyUsage)
+			os.Exit(2)
+		}
+
+		revoked, err := repo.RevokeAPIKey(ctx, int32(id))
+		if err != nil {
+			logger.Fatal("unable to revoke api key: ", zap.Error(err))
+		}
+		if revoked == 0 {
+			fmt.Printf("key %d not found or already revoked\n", id)
+			os.Exit(1)
+		}
+		fmt.Printf("revoked key %d\n", id)
+	default:
+		fmt.Println(apiKeyUsage)
+		os.Exit(2)
+	}
+}
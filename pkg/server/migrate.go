@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Ser9unin/WeatherForecast/config"
+	"github.com/Ser9unin/WeatherForecast/pkg/db/migrations"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  status     список миграций и отметка о применении
+  up         применить все новые миграции
+  down [N]   откатить N последних миграций, по умолчанию 1`
+
+// Migrate выполняет подкоманду migrate: status, up или down
+func Migrate(args []string) {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+
+	cfgDB := config.NewDBConnectionCfg()
+	db, err := openDB(cfgDB)
+	if err != nil {
+		logger.Fatal("unable to start db: ", zap.Error(err))
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db, logger)
+	if err != nil {
+		logger.Fatal("unable to load migrations: ", zap.Error(err))
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Fatal("unable to get migrations status: ", zap.Error(err))
+		}
+
+		for _, status := range statuses {
+			appliedAt := "not applied"
+			if status.AppliedAt.Valid {
+				appliedAt = status.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, appliedAt)
+		}
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Fatal("unable to apply migrations: ", zap.Error(err))
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Println(migrateUsage)
+				os.Exit(2)
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			logger.Fatal("unable to revert migrations: ", zap.Error(err))
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/api"
+)
+
+const openapiUsage = `usage: main openapi <command>
+
+commands:
+  check      сверить маршруты сервиса с pkg/api/openapi.json, при расхождении код выхода 1`
+
+// OpenAPI выполняет подкоманду openapi, работает без БД и без сети
+func OpenAPI(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Println(openapiUsage)
+		os.Exit(2)
+	}
+
+	a := api.NewAPI(nil, nil, nil, nil, nil, api.Config{}, nil)
+	router, routes := newRouter(&a, api.NewHealth(nil, nil, nil, 0))
+
+	drift := apiSpecDrift(router, routes)
+	for _, item := range drift {
+		fmt.Println(item)
+	}
+	if len(drift) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%d routes match openapi.json\n", len(routes))
+}
@@ -0,0 +1,357 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ser9unin/WeatherForecast/pkg/alerts"
+	"github.com/Ser9unin/WeatherForecast/pkg/api"
+	"github.com/Ser9unin/WeatherForecast/pkg/cache"
+	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
+	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
+	"go.uber.org/zap"
+)
+
+// методы, которыми проверяется каждый путь из описания
+var probeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// TestRoutesMatchSpec обходит все пути и методы из openapi.json на настоящем роутере:
+// описанный метод с параметрами из описания должен доходить до обработчика,
+// неописанный метод должен отклоняться с 405, а неописанный путь внутри маршрута с 404
+func TestRoutesMatchSpec(t *testing.T) {
+	router := newTestRouter(t)
+	spec := loadServedSpec(t, router)
+
+	for path, item := range spec.Paths {
+		target := strings.NewReplacer("{id}", "1").Replace(path)
+
+		for _, method := range probeMethods {
+			op, documented := item.operations[strings.ToLower(method)]
+
+			var query url.Values
+			var body io.Reader
+			if documented {
+				query = sampleQuery(t, path, method, spec, append(append([]testParameter{}, item.common...), op.Parameters...))
+				if op.RequestBody != nil {
+					body = strings.NewReader("{}")
+				}
+			}
+
+			code := serve(router, method, target, query, body)
+			switch {
+			case !documented && code != http.StatusMethodNotAllowed:
+				t.Errorf("%s %s is not described in openapi.json, got %d, want 405", method, path, code)
+			case documented && (code == http.StatusNotFound || code == http.StatusMethodNotAllowed):
+				t.Errorf("%s %s is described in openapi.json, got %d", method, path, code)
+			case documented && code == http.StatusBadRequest && op.RequestBody == nil:
+				t.Errorf("%s %s rejects parameters from openapi.json: %s", method, path, query.Encode())
+			}
+		}
+
+		// маршруты-поддеревья не должны обрабатывать пути глубже описанных
+		deeper := path + "/undescribed"
+		if spec.describes(deeper) {
+			continue
+		}
+		code := serve(router, http.MethodGet, target+"/undescribed", nil, nil)
+		if code != http.StatusNotFound {
+			t.Errorf("GET %s is not described in openapi.json, got %d, want 404", deeper, code)
+		}
+	}
+}
+
+func TestSpecDrift(t *testing.T) {
+	a := api.NewAPI(nil, nil, nil, nil, nil, api.Config{}, nil)
+	router, routes := newRouter(&a, api.NewHealth(nil, nil, nil, 0))
+
+	for _, drift := range apiSpecDrift(router, routes) {
+		t.Error(drift)
+	}
+}
+
+// ключ администратора, с которым идут все запросы, поэтому запросы доходят до обработчиков
+const testAdminKey = "wf_test"
+
+func serve(router http.Handler, method, path string, query url.Values, body io.Reader) int {
+	r := httptest.NewRequest(method, path, body)
+	r.URL.RawQuery = query.Encode()
+	r.Header.Set("X-API-Key", testAdminKey)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+// newTestRouter роутер со всеми зависимостями, БД заменена заглушкой:
+// ключ API находится и считается ключом администратора, остальные запросы к БД завершаются ошибкой
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	db := sql.OpenDB(stubConnector{})
+	t.Cleanup(func() { db.Close() })
+
+	provider, err := openweather.NewFakeProviderFromFile("../model.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zap.NewNop()
+	storage := repository.New(db)
+	cities := openweather.NewOpenWeatherAPI(storage, provider, nil, logger)
+	points := cache.NewPointForecasts(provider, time.Minute, ratelimit.Rate{Limit: 1000, Per: time.Minute}, time.Second)
+
+	a := api.NewAPI(storage, cities, cache.NewForecastCache(time.Minute), points, alerts.NewEngine(storage, logger), api.Config{DefaultUnits: api.Units("metric")}, logger)
+	router, _ := newRouter(&a, api.NewHealth(db, cities, storage, time.Hour))
+
+	return router
+}
+
+// часть openapi.json, нужная для обхода путей и методов
+type testSpec struct {
+	Paths      map[string]testPathItem `json:"paths"`
+	Components struct {
+		Parameters map[string]testParameter `json:"parameters"`
+		Schemas    map[string]testSchema    `json:"schemas"`
+	} `json:"components"`
+}
+
+// describes true, если путь совпадает с одним из путей описания, сегменты вида {id} совпадают с любым значением
+func (s testSpec) describes(path string) bool {
+	segments := strings.Split(path, "/")
+
+	for template := range s.Paths {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		match := true
+		for i, part := range parts {
+			if part != segments[i] && !strings.HasPrefix(part, "{") {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+type testPathItem struct {
+	common     []testParameter
+	operations map[string]testOperation
+}
+
+func (p *testPathItem) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	p.operations = make(map[string]testOperation)
+	for key, value := range raw {
+		if key == "parameters" {
+			err = json.Unmarshal(value, &p.common)
+		} else {
+			var op testOperation
+			err = json.Unmarshal(value, &op)
+			p.operations[key] = op
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+type testOperation struct {
+	Parameters  []testParameter `json:"parameters"`
+	RequestBody json.RawMessage `json:"requestBody"`
+}
+
+type testParameter struct {
+	Ref      string      `json:"$ref"`
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Example  interface{} `json:"example"`
+	Schema   testSchema  `json:"schema"`
+}
+
+type testSchema struct {
+	Ref              string        `json:"$ref"`
+	Type             string        `json:"type"`
+	Enum             []interface{} `json:"enum"`
+	Minimum          *float64      `json:"minimum"`
+	ExclusiveMinimum bool          `json:"exclusiveMinimum"`
+	Items            *testSchema   `json:"items"`
+}
+
+// описание берётся из ответа /openapi.json, то есть проверяется то, что видят клиенты
+func loadServedSpec(t *testing.T, router http.Handler) testSpec {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: %d", w.Code)
+	}
+
+	var spec testSpec
+	err := json.Unmarshal(w.Body.Bytes(), &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Paths) == 0 {
+		t.Fatal("openapi.json has no paths")
+	}
+
+	return spec
+}
+
+// sampleQuery параметры запроса со значениями, допустимыми по описанию:
+// example параметра, первое значение enum, минимум для чисел
+func sampleQuery(t *testing.T, path, method string, spec testSpec, params []testParameter) url.Values {
+	t.Helper()
+
+	query := make(url.Values)
+	for _, param := range params {
+		if param.Ref != "" {
+			param = spec.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+		}
+		if param.In != "query" {
+			continue
+		}
+
+		value, ok := sampleValue(spec, param)
+		if !ok {
+			if param.Required {
+				t.Errorf("%s %s: no example for required parameter %s", method, path, param.Name)
+			}
+			continue
+		}
+		query.Set(param.Name, value)
+	}
+
+	return query
+}
+
+func sampleValue(spec testSpec, param testParameter) (string, bool) {
+	if param.Example != nil {
+		return fmt.Sprint(param.Example), true
+	}
+
+	return sampleSchemaValue(spec, param.Schema)
+}
+
+func sampleSchemaValue(spec testSpec, schema testSchema) (string, bool) {
+	if schema.Ref != "" {
+		schema = spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if len(schema.Enum) > 0 {
+		return fmt.Sprint(schema.Enum[0]), true
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		if schema.Minimum == nil {
+			return "1", true
+		}
+		if schema.ExclusiveMinimum {
+			return fmt.Sprint(*schema.Minimum + 1), true
+		}
+		return fmt.Sprint(*schema.Minimum), true
+	case "boolean":
+		return "true", true
+	case "array":
+		if schema.Items == nil {
+			return "", false
+		}
+		return sampleSchemaValue(spec, *schema.Items)
+	default:
+		return "", false
+	}
+}
+
+// заглушка БД: находит любой ключ API как ключ администратора и учитывает запрос,
+// на все остальные запросы отвечает ошибкой, поэтому обработчики отвечают 500, а не паникуют
+var errStubDB = errors.New("stub db")
+
+type stubConnector struct{}
+
+func (stubConnector) Connect(context.Context) (driver.Conn, error) { return stubConn{}, nil }
+
+func (stubConnector) Driver() driver.Driver { return nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, errStubDB }
+
+func (stubConn) Close() error { return nil }
+
+func (stubConn) Begin() (driver.Tx, error) { return nil, errStubDB }
+
+func (stubConn) Ping(context.Context) error { return errStubDB }
+
+func (stubConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return nil, errStubDB
+}
+
+func (stubConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(query, "-- name: APIKeyByHash"):
+		return &stubRows{
+			columns: []string{"id", "name", "prefix", "key_hash", "is_admin", "daily_quota", "monthly_quota", "created_at", "revoked_at"},
+			values:  []driver.Value{int64(1), "test", testAdminKey, []byte{}, true, int64(0), int64(0), time.Now(), nil},
+		}, nil
+	case strings.HasPrefix(query, "-- name: UseAPIKey"):
+		return &stubRows{
+			columns: []string{"daily_requests", "monthly_requests"},
+			values:  []driver.Value{int64(1), int64(1)},
+		}, nil
+	default:
+		return nil, errStubDB
+	}
+}
+
+// stubRows одна строка с values
+type stubRows struct {
+	columns []string
+	values  []driver.Value
+	done    bool
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+
+func (r *stubRows) Close() error { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+
+	return nil
+}
@@ -8,14 +8,21 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "github.com/jackc/pgx/stdlib"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Ser9unin/WeatherForecast/config"
+	"github.com/Ser9unin/WeatherForecast/pkg/alerts"
 	"github.com/Ser9unin/WeatherForecast/pkg/api"
+	"github.com/Ser9unin/WeatherForecast/pkg/cache"
+	"github.com/Ser9unin/WeatherForecast/pkg/db/migrations"
 	"github.com/Ser9unin/WeatherForecast/pkg/db/repository"
 	openweather "github.com/Ser9unin/WeatherForecast/pkg/external"
+	"github.com/Ser9unin/WeatherForecast/pkg/metrics"
+	"github.com/Ser9unin/WeatherForecast/pkg/middleware"
+	"github.com/Ser9unin/WeatherForecast/pkg/ratelimit"
 	"go.uber.org/zap"
 )
 
@@ -42,46 +49,98 @@ func Run() {
 	logger.Info("reading config")
 
 	cfgDB := config.NewDBConnectionCfg()
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode= %s",
-		cfgDB.HostAddress,
-		cfgDB.HostPort,
-		cfgDB.User,
-		cfgDB.Password,
-		cfgDB.DBName,
-		cfgDB.SSLMode)
-
-	db, err := sql.Open("pgx", dsn)
+	db, err := openDB(cfgDB)
 	if err != nil {
 		logger.Fatal("unable to start db: ", zap.Error(err))
 	}
 	defer db.Close()
 
+	// сервис запускается и без БД, пока БД недоступна /readyz отвечает 503
 	err = db.PingContext(ctx)
 	if err != nil {
-		logger.Error("context cancelled", zap.Error(err))
+		logger.Error("БД недоступна", zap.Error(err))
+	}
+
+	// схема БД обновляется при старте, отключается DB_AUTO_MIGRATE=false,
+	// тогда миграции применяются командой migrate up
+	var migrator *migrations.Migrator
+	if cfgDB.AutoMigrate {
+		migrator, err = migrations.NewMigrator(db, logger)
+		if err != nil {
+			logger.Fatal("unable to load migrations: ", zap.Error(err))
+		}
 	}
 
 	storage := repository.New(db)
-	api := api.NewAPI(storage, logger)
-	router := api.NewRouter()
+	metrics.RegisterDB(db, "weather")
 
-	logger.Info("запускается работа с сервисом openweather")
+	providercfg := config.NewProviderCfg()
+	provider, err := newProvider(providercfg, logger)
+	if err != nil {
+		logger.Fatal("unable to create forecast provider: ", zap.Error(err))
+	}
+
+	ingestioncfg := config.NewIngestionCfg()
+	newOpenWeatherConnect := openweather.NewOpenWeatherAPI(storage, provider, ingestioncfg.SeedCities, logger)
+
+	// кэш прогнозов сбрасывается по городу после каждой записи прогноза в БД
+	cachecfg := config.NewCacheCfg()
+	fcCache := cache.NewForecastCache(cachecfg.TTL)
+	fcCache.RegisterMetrics()
+	newOpenWeatherConnect.AddListener(fcCache)
+
+	// правила оповещений проверяются по каждому записанному прогнозу
+	alertEngine := alerts.NewEngine(storage, logger)
+	newOpenWeatherConnect.AddListener(alertEngine)
+
+	// прогнозы по произвольным координатам запрашиваются у того же источника с теми же лимитами
+	// и дополнительно ограничены своим лимитом
+	pointcfg := config.NewPointCfg()
+	points := cache.NewPointForecasts(provider, pointcfg.TTL, pointcfg.Rate, pointcfg.Timeout)
+	points.RegisterMetrics()
+
+	healthcfg := config.NewHealthCfg()
+	health := api.NewHealth(db, newOpenWeatherConnect, storage, healthcfg.MaxForecastAge)
+
+	apicfg := config.NewAPICfg()
+	authcfg := config.NewAuthCfg()
+	ratelimitcfg := config.NewRateLimitCfg()
+	api := api.NewAPI(storage, newOpenWeatherConnect, fcCache, points, alertEngine, api.Config{
+		DefaultUnits:    api.Units(apicfg.DefaultUnits),
+		AuthEnabled:     authcfg.Enabled,
+		RateLimit:       ratelimitcfg.Default,
+		RouteRateLimits: ratelimitcfg.Routes,
+		TrustedProxies:  ratelimitcfg.TrustedProxies,
+	}, logger)
+	router, routes := newRouter(&api, health)
+
+	// расхождения маршрутов с openapi.json не мешают работе, но описание нужно поправить
+	for _, drift := range apiSpecDrift(router, routes) {
+		logger.Warn("маршрут не совпадает с openapi.json", zap.String("drift", drift))
+	}
+
+	logger.Info("запускается работа с источником прогнозов", zap.String("provider", providercfg.Provider))
 	go func() {
-		openweathercfg := config.NewOpenWeatherAPIID()
+		// загрузка прогнозов начинается только после миграций, до этого /readyz отвечает 503
+		if migrator != nil {
+			err := migrate(ctx, migrator, logger)
+			if err != nil {
+				return
+			}
+		}
 
 		// запускаем подключение к внешнему сервису и загрузку прогнозов в БД
-		newOpenWeatherConnect := openweather.NewOpenWeatherAPI(storage, logger)
-		newOpenWeatherConnect.OpenWeatherRun(ctx, openweathercfg.APIID)
+		newOpenWeatherConnect.OpenWeatherRun(ctx)
 
 		// параллельное асинхронное обновление данных по прогнозу раз в 15 минут
-		newOpenWeatherConnect.ParallelConcurrentUpd(ctx, openweathercfg.APIID)
+		newOpenWeatherConnect.ParallelConcurrentUpd(ctx)
 	}()
 
 	// запускаем сервер
 	srvcfg := config.NewServerCfg()
 	srv := &http.Server{
 		Addr:    srvcfg.Port,
-		Handler: router,
+		Handler: middleware.Metrics(router),
 	}
 
 	logger.Info("запускается http сервер")
@@ -99,3 +158,86 @@ func Run() {
 		fmt.Printf("exit reason: %s \n", err)
 	}
 }
+
+// newRouter маршруты API и проверки для оркестратора, возвращает и список зарегистрированных маршрутов
+func newRouter(a *api.API, health *api.Health) (*http.ServeMux, []string) {
+	router := a.NewRouter()
+
+	// проверки для оркестратора не пишутся в лог, что бы не засорять его
+	router.HandleFunc("/healthz", health.Healthz)
+	router.HandleFunc("/readyz", health.Readyz)
+
+	return router, append(a.Routes(), "/healthz", "/readyz")
+}
+
+// в Run имя api занято переменной, поэтому функция пакета вызывается через обёртку
+func apiSpecDrift(router *http.ServeMux, routes []string) []string {
+	return api.SpecDrift(router, routes)
+}
+
+// пауза между попытками применить миграции растёт вдвое до migrateMaxBackoff
+const (
+	migrateBackoff    = time.Second
+	migrateMaxBackoff = 30 * time.Second
+)
+
+// migrate применяет миграции, повторяя попытки, пока БД недоступна, ошибка только при остановке сервиса
+func migrate(ctx context.Context, migrator *migrations.Migrator, logger *zap.Logger) error {
+	wait := migrateBackoff
+	for {
+		applied, err := migrator.Up(ctx)
+		if err == nil {
+			logger.Info("миграции применены", zap.Int("applied", applied))
+			return nil
+		}
+		logger.Error("миграции не применены, повтор", zap.Duration("wait", wait), zap.Error(err))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		wait = min(wait*2, migrateMaxBackoff)
+	}
+}
+
+// выбираем источник прогнозов в зависимости от конфигурации
+func newProvider(cfg config.ProviderCfg, logger *zap.Logger) (openweather.Provider, error) {
+	if cfg.Provider == config.ProviderFake {
+		return openweather.NewFakeProviderFromFile(cfg.FakeFixture)
+	}
+
+	// один ограничитель на все запросы к openweather, токен берётся на каждую попытку, включая повторы
+	limiter := ratelimit.NewLimiter(
+		ratelimit.Rate{Limit: cfg.RequestsPerMinute, Per: time.Minute},
+		ratelimit.Rate{Limit: cfg.RequestsPerDay, Per: 24 * time.Hour},
+	)
+
+	client := middleware.NewClient("openweather", middleware.ClientCfg{
+		Timeout:          cfg.Timeout,
+		MaxRetries:       cfg.Retries,
+		BaseBackoff:      500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		MaxRetryAfter:    time.Minute,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  cfg.BreakerCooldown,
+		Limiter:          limiter,
+	}, logger)
+
+	return openweather.NewOpenWeatherProvider(cfg.BaseURL, cfg.APIID, client, logger), nil
+}
+
+func openDB(cfgDB config.DBConnectionCfg) (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode= %s",
+		cfgDB.HostAddress,
+		cfgDB.HostPort,
+		cfgDB.User,
+		cfgDB.Password,
+		cfgDB.DBName,
+		cfgDB.SSLMode)
+
+	return sql.Open("pgx", dsn)
+}